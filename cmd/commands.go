@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"infosir/internal/db"
+	"infosir/internal/db/repository"
+	"infosir/internal/utils"
+	natsinfosir "infosir/pkg/nats"
+)
+
+// runCommand runs a one-off maintenance subcommand instead of the service:
+//
+//	infosir dlq-replay [-limit N] [-dry-run]   republish dead-lettered messages to their original subject
+//	infosir stream-replay [-start-seq N | -start-time T] [-filter S] [-batch N] [-progress D] [-dry-run]
+//	                                          rebuild stored klines from the messages retained in the kline stream
+func runCommand(ctx context.Context, name string, args []string) error {
+	switch name {
+	case "dlq-replay":
+		return runDLQReplay(ctx, args)
+	case "stream-replay":
+		return runStreamReplay(ctx, args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// runDLQReplay replays the dead-letter stream back into the kline stream.
+func runDLQReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dlq-replay", flag.ContinueOnError)
+	limit := fs.Int("limit", 0, "maximum number of messages to replay (0 = all)")
+	dryRun := fs.Bool("dry-run", false, "only log the messages that would be replayed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	nc, js, err := natsinfosir.InitNATSJetStream()
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	replayed, err := natsinfosir.ReplayDLQ(ctx, js, *limit, *dryRun)
+	utils.Logger.Info("DLQ replay finished", zap.Int("replayed", replayed), zap.Bool("dryRun", *dryRun))
+	return err
+}
+
+// runStreamReplay replays the kline stream into the database, e.g. after the database was wiped.
+// The database is migrated first, unless dry-running.
+func runStreamReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stream-replay", flag.ContinueOnError)
+	startSeq := fs.Uint64("start-seq", 0, "first stream sequence to replay (0 = the first retained message)")
+	startTime := fs.String("start-time", "", "replay messages stored at or after this RFC3339 time instead")
+	filter := fs.String("filter", "", "subject filter within the stream, e.g. infosir.kline.binance.> (default: every retained message)")
+	batch := fs.Int("batch", utils.GetConfig().NATS.FetchBatch, "messages merged and inserted together")
+	every := fs.Duration("progress", 5*time.Second, "how often to log progress")
+	dryRun := fs.Bool("dry-run", false, "only decode and count the messages, write nothing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := natsinfosir.ReplayOptions{StartSeq: *startSeq, Filter: *filter, BatchSize: *batch, DryRun: *dryRun}
+	if *startTime != "" {
+		t, err := time.Parse(time.RFC3339, *startTime)
+		if err != nil {
+			return fmt.Errorf("invalid -start-time: %w", err)
+		}
+		opts.StartTime = t
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	var klineRepo *repository.KlineRepository
+	if !opts.DryRun {
+		dbPool, err := db.InitDatabase()
+		if err != nil {
+			return err
+		}
+		defer dbPool.Close()
+		klineRepo = repository.NewKlineRepository(dbPool)
+	}
+
+	nc, js, err := natsinfosir.InitNATSJetStream()
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	var lastReport time.Time
+	report := func(p natsinfosir.ReplayProgress) {
+		if time.Since(lastReport) < *every {
+			return
+		}
+		lastReport = time.Now()
+		utils.Logger.Info("Stream replay progress", replayFields(p)...)
+	}
+
+	p, err := natsinfosir.ReplayStream(ctx, js, klineRepo, opts, report)
+	if err != nil {
+		utils.Logger.Error("Stream replay stopped; resume with -start-seq",
+			append(replayFields(p), zap.Uint64("resumeSeq", p.StoredSeq+1))...)
+		return err
+	}
+	utils.Logger.Info("Stream replay finished", append(replayFields(p), zap.Bool("dryRun", opts.DryRun))...)
+	return nil
+}
+
+// replayFields returns the log fields of a replay progress report.
+func replayFields(p natsinfosir.ReplayProgress) []zap.Field {
+	rate := 0.0
+	if p.Elapsed > 0 {
+		rate = float64(p.Messages) / p.Elapsed.Seconds()
+	}
+	return []zap.Field{
+		zap.Uint64("messages", p.Messages),
+		zap.Uint64("undecodable", p.Undecodable),
+		zap.Uint64("klines", p.Klines),
+		zap.Uint64("stored", p.Stored),
+		zap.Uint64("lastSeq", p.LastSeq),
+		zap.Uint64("targetSeq", p.TargetSeq),
+		zap.String("percent", fmt.Sprintf("%.1f", p.Percent())),
+		zap.Float64("msgsPerSec", rate),
+		zap.Duration("elapsed", p.Elapsed),
+	}
+}
@@ -2,6 +2,11 @@ package config
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"infosir/internal/models"
 
 	"github.com/caarlos0/env/v11"
 	validation "github.com/go-ozzo/ozzo-validation"
@@ -27,6 +32,17 @@ type Config struct {
 
 	// SyncEnabled toggles whether historical synchronization is run on startup.
 	SyncEnabled bool `env:"SYNC_ENABLED" envDefault:"true"`
+
+	// BackfillConcurrency is how many backfill jobs (one pair each) run at the same time.
+	BackfillConcurrency int `env:"BACKFILL_CONCURRENCY" envDefault:"4"`
+
+	// StreamEnabled switches live ingestion from per-minute REST polling to Binance WebSocket kline streams.
+	StreamEnabled bool `env:"STREAM_ENABLED" envDefault:"false"`
+
+	// GapHealInterval is how often stored klines are scanned for gaps, which are then re-fetched. 0 disables healing.
+	GapHealInterval time.Duration `env:"GAP_HEAL_INTERVAL" envDefault:"10m"`
+	// GapScanWindow limits every gap scan to the most recent part of the history.
+	GapScanWindow time.Duration `env:"GAP_SCAN_WINDOW" envDefault:"168h"`
 }
 
 // DatabaseConfig holds all the required DB connection parameters.
@@ -48,14 +64,78 @@ type NATSConfig struct {
 	// URL is the connection string for NATS server, e.g. "nats://127.0.0.1:4222"
 	URL string `env:"NATS_URL,required"`
 
-	// Subject is the subject/channel used to publish new Kline data.
-	Subject string `env:"NATS_SUBJECT" envDefault:"infosir_kline"`
+	// Subject is the prefix of the kline subjects "<prefix>.<exchange>.<symbol>.<interval>".
+	Subject string `env:"NATS_SUBJECT" envDefault:"infosir.kline"`
+
+	// Codec is the wire format of published kline messages: json, msgpack or protobuf.
+	// The consumer decodes any of them, judging by the Content-Type header.
+	Codec string `env:"NATS_CODEC" envDefault:"json"`
 
 	// StreamName is the name of the JetStream stream.
 	StreamName string `env:"JETSTREAM_STREAM_NAME" envDefault:"infosir_kline_stream"`
 
 	// ConsumerName is the name of the JetStream consumer (durable).
 	ConsumerName string `env:"JETSTREAM_CONSUMER" envDefault:"infosir_kline_consumer"`
+
+	// ConsumerFilter is the filter subject of the storing consumer. Empty means every exchange
+	// and symbol of KLINE_INTERVAL, i.e. "<prefix>.*.*.<interval>".
+	ConsumerFilter string `env:"JETSTREAM_CONSUMER_FILTER"`
+
+	// StreamRetention is the retention policy of the kline stream: limits, interest or workqueue.
+	StreamRetention string `env:"JETSTREAM_RETENTION" envDefault:"limits"`
+
+	// StreamMaxAge is how long the stream keeps messages; 0 keeps them until other limits apply.
+	StreamMaxAge time.Duration `env:"JETSTREAM_MAX_AGE" envDefault:"0"`
+
+	// StreamMaxBytes caps the size of the stream; -1 means unlimited.
+	StreamMaxBytes int64 `env:"JETSTREAM_MAX_BYTES" envDefault:"-1"`
+
+	// StreamStorage is the storage backend of the stream: file or memory.
+	StreamStorage string `env:"JETSTREAM_STORAGE" envDefault:"file"`
+
+	// StreamReplicas is the number of stream replicas in a clustered deployment.
+	StreamReplicas int `env:"JETSTREAM_REPLICAS" envDefault:"1"`
+
+	// StreamDiscard decides which messages go once a limit is hit: old or new.
+	StreamDiscard string `env:"JETSTREAM_DISCARD" envDefault:"old"`
+
+	// DuplicateWindow is how long the stream remembers message IDs to drop re-published klines.
+	// It should cover KLINE_LIMIT candles of the scheduled intervals, as those are re-fetched.
+	DuplicateWindow time.Duration `env:"JETSTREAM_DUPLICATE_WINDOW" envDefault:"2h"`
+
+	// FetchBatch is the maximum number of messages the consumer fetches and stores at once.
+	FetchBatch int `env:"JETSTREAM_FETCH_BATCH" envDefault:"100"`
+
+	// FetchMaxWait is how long a fetch waits for a batch to fill up.
+	FetchMaxWait time.Duration `env:"JETSTREAM_FETCH_MAX_WAIT" envDefault:"1s"`
+
+	// MaxAckPending limits the messages delivered to the consumer but not acknowledged yet.
+	MaxAckPending int `env:"JETSTREAM_MAX_ACK_PENDING" envDefault:"1000"`
+
+	// AckWait is how long the server waits for an ack before redelivering a message.
+	AckWait time.Duration `env:"JETSTREAM_ACK_WAIT" envDefault:"30s"`
+
+	// MaxDeliver is how many times a message is delivered before it is moved to the dead-letter stream.
+	MaxDeliver int `env:"JETSTREAM_MAX_DELIVER" envDefault:"5"`
+
+	// NakDelay is the redelivery delay after the first failed delivery; it doubles with every retry.
+	NakDelay time.Duration `env:"JETSTREAM_NAK_DELAY" envDefault:"1s"`
+
+	// NakMaxDelay caps the redelivery delay.
+	NakMaxDelay time.Duration `env:"JETSTREAM_NAK_MAX_DELAY" envDefault:"1m"`
+
+	// QueryService enables the NATS micro service answering kline.query, kline.latest and kline.symbols.
+	QueryService bool `env:"NATS_QUERY_SERVICE" envDefault:"true"`
+
+	// LatestBucket is the Key-Value bucket holding the latest candle per exchange.symbol.interval;
+	// empty disables it.
+	LatestBucket string `env:"NATS_KV_LATEST_BUCKET" envDefault:"infosir_latest_klines"`
+
+	// DLQSubject is the subject poisoned messages are republished to.
+	DLQSubject string `env:"NATS_DLQ_SUBJECT" envDefault:"infosir_kline_dlq"`
+
+	// DLQStreamName is the name of the work-queue stream holding dead-lettered messages.
+	DLQStreamName string `env:"JETSTREAM_DLQ_STREAM_NAME" envDefault:"infosir_kline_dlq_stream"`
 }
 
 // CryptoConfig holds configuration for interacting with the Binance or other crypto APIs.
@@ -66,12 +146,55 @@ type CryptoConfig struct {
 	// BinanceKlinesPoint is the path to the klines endpoint, e.g. "api/v3/klines"
 	BinanceKlinesPoint string `env:"KLINES_POINT" envDefault:"api/v3/klines"`
 
-	// Pairs is a comma-separated list of trading pairs, e.g. "BTCUSDT,ETHUSDT"
+	// BinanceWSURL is the combined-stream WebSocket endpoint, e.g. "wss://fstream.binance.com/stream"
+	BinanceWSURL string `env:"BINANCE_WS_URL" envDefault:"wss://fstream.binance.com/stream"`
+
+	// StreamPublishOpen additionally publishes in-progress (not yet closed) candles from the WebSocket stream.
+	StreamPublishOpen bool `env:"STREAM_PUBLISH_OPEN" envDefault:"false"`
+
+	// BinanceWeightLimit is the request weight budget per minute shared by all Binance calls.
+	// Binance allows 2400 for USD-M futures and 6000 for spot; we keep a safety margin.
+	BinanceWeightLimit int `env:"BINANCE_WEIGHT_LIMIT" envDefault:"2000"`
+
+	// Pairs is a comma-separated list of Binance trading pairs, e.g. "BTCUSDT,ETHUSDT"
 	Pairs []string `env:"PAIRS" envSeparator:","`
 
-	// KlineInterval is the default timeframe to fetch, e.g. "1m"
+	// BybitBaseURL is the base endpoint for Bybit v5 REST calls.
+	BybitBaseURL string `env:"BYBIT_BASE_URL" envDefault:"https://api.bybit.com"`
+
+	// BybitCategory is the Bybit product category, e.g. "linear" (USDT perpetuals) or "spot".
+	BybitCategory string `env:"BYBIT_CATEGORY" envDefault:"linear"`
+
+	// BybitRequestLimit is the number of Bybit requests allowed per minute.
+	BybitRequestLimit int `env:"BYBIT_REQUEST_LIMIT" envDefault:"600"`
+
+	// BybitPairs is a comma-separated list of Bybit symbols, e.g. "BTCUSDT". Empty disables Bybit.
+	BybitPairs []string `env:"BYBIT_PAIRS" envSeparator:","`
+
+	// OKXBaseURL is the base endpoint for OKX v5 REST calls.
+	OKXBaseURL string `env:"OKX_BASE_URL" envDefault:"https://www.okx.com"`
+
+	// OKXRequestLimit is the number of OKX requests allowed per minute.
+	OKXRequestLimit int `env:"OKX_REQUEST_LIMIT" envDefault:"300"`
+
+	// OKXPairs is a comma-separated list of OKX instrument IDs, e.g. "BTC-USDT-SWAP". Empty disables OKX.
+	OKXPairs []string `env:"OKX_PAIRS" envSeparator:","`
+
+	// KlineInterval is the timeframe stored in futures_klines. It must be "1m": the continuous
+	// aggregates, on-the-fly aggregation and gap detection are all built on 1m candles.
 	KlineInterval string `env:"KLINE_INTERVAL" envDefault:"1m"`
 
+	// ScheduleIntervals is a comma-separated list of intervals polled by the scheduler, e.g. "1m,5m,1h".
+	// Each one is fetched right after its candles close. Only KlineInterval is stored.
+	ScheduleIntervals []string `env:"SCHEDULE_INTERVALS" envSeparator:"," envDefault:"1m"`
+
+	// FetchConcurrency is how many pairs the scheduler fetches in parallel in every cycle.
+	FetchConcurrency int `env:"FETCH_CONCURRENCY" envDefault:"8"`
+
+	// ScheduleSettleDelay is how long after a candle close the scheduler waits before fetching,
+	// giving the exchange time to finalise the candle.
+	ScheduleSettleDelay time.Duration `env:"SCHEDULE_SETTLE_DELAY" envDefault:"2s"`
+
 	// KlineLimit is the number of klines to fetch in one request (max ~1000 for Binance).
 	KlineLimit int `env:"KLINE_LIMIT" envDefault:"10"`
 }
@@ -80,6 +203,9 @@ type CryptoConfig struct {
 func (c *Config) Validate() error {
 	return validation.ValidateStruct(c,
 		validation.Field(&c.HTTPPort, validation.Required, validation.Min(1)),
+		validation.Field(&c.BackfillConcurrency, validation.Required, validation.Min(1)),
+		validation.Field(&c.GapHealInterval, validation.Min(time.Duration(0))),
+		validation.Field(&c.GapScanWindow, validation.Required, validation.Min(time.Minute)),
 	)
 }
 
@@ -98,8 +224,28 @@ func (d DatabaseConfig) Validate() error {
 func (n NATSConfig) Validate() error {
 	return validation.ValidateStruct(&n,
 		validation.Field(&n.URL, validation.Required),
+		validation.Field(&n.Subject, validation.Required, validation.Match(subjectPrefixPattern)),
+		validation.Field(&n.ConsumerFilter, validation.By(n.isUnderSubject)),
+		validation.Field(&n.Codec, validation.In("json", "msgpack", "protobuf")),
 		validation.Field(&n.StreamName, validation.Required),
 		validation.Field(&n.ConsumerName, validation.Required),
+		validation.Field(&n.StreamRetention, validation.In("limits", "interest", "workqueue")),
+		validation.Field(&n.StreamMaxAge, validation.Min(time.Duration(0))),
+		validation.Field(&n.StreamMaxBytes, validation.Min(int64(-1))),
+		validation.Field(&n.StreamStorage, validation.In("file", "memory")),
+		validation.Field(&n.StreamReplicas, validation.Required, validation.Min(1), validation.Max(5)),
+		validation.Field(&n.StreamDiscard, validation.In("old", "new")),
+		validation.Field(&n.DuplicateWindow, validation.Required, validation.By(n.isWithinMaxAge)),
+		validation.Field(&n.AckWait, validation.Required),
+		validation.Field(&n.FetchBatch, validation.Required, validation.Min(1)),
+		validation.Field(&n.FetchMaxWait, validation.Required),
+		validation.Field(&n.MaxAckPending, validation.Required, validation.Min(1)),
+		validation.Field(&n.MaxDeliver, validation.Required, validation.Min(1)),
+		validation.Field(&n.NakDelay, validation.Required),
+		validation.Field(&n.NakMaxDelay, validation.Required),
+		validation.Field(&n.LatestBucket, validation.Match(bucketNamePattern)),
+		validation.Field(&n.DLQSubject, validation.Required),
+		validation.Field(&n.DLQStreamName, validation.Required),
 	)
 }
 
@@ -108,11 +254,68 @@ func (cc CryptoConfig) Validate() error {
 	return validation.ValidateStruct(&cc,
 		validation.Field(&cc.BinanceBaseURL, validation.Required),
 		validation.Field(&cc.BinanceKlinesPoint, validation.Required),
+		validation.Field(&cc.BinanceWeightLimit, validation.Required, validation.Min(1)),
 		validation.Field(&cc.Pairs, validation.Required, validation.Length(1, 0)),
+		validation.Field(&cc.BybitRequestLimit, validation.Min(1)),
+		validation.Field(&cc.OKXRequestLimit, validation.Min(1)),
 		validation.Field(&cc.KlineLimit, validation.Required, validation.Min(1)),
+		validation.Field(&cc.KlineInterval, validation.Required,
+			validation.In(models.Interval1m.String()).Error("must be 1m: stored klines are aggregated as 1m candles")),
+		validation.Field(&cc.ScheduleIntervals, validation.Each(validation.By(isInterval))),
+		validation.Field(&cc.ScheduleSettleDelay, validation.Min(time.Duration(0))),
+		validation.Field(&cc.FetchConcurrency, validation.Required, validation.Min(1)),
 	)
 }
 
+// subjectPrefixPattern matches literal subjects: dot-separated tokens without wildcards.
+var subjectPrefixPattern = regexp.MustCompile(`^[^.*>\s]+(\.[^.*>\s]+)*$`)
+
+// bucketNamePattern matches valid JetStream Key-Value bucket names.
+var bucketNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// isUnderSubject is a validation rule for filter subjects within the kline stream.
+func (n NATSConfig) isUnderSubject(value interface{}) error {
+	s, _ := value.(string)
+	if s != "" && !strings.HasPrefix(s, n.Subject+".") {
+		return fmt.Errorf("must start with %q", n.Subject+".")
+	}
+	return nil
+}
+
+// isWithinMaxAge is a validation rule for durations that must not exceed a set StreamMaxAge.
+func (n NATSConfig) isWithinMaxAge(value interface{}) error {
+	d, _ := value.(time.Duration)
+	if n.StreamMaxAge > 0 && d > n.StreamMaxAge {
+		return fmt.Errorf("must not exceed JETSTREAM_MAX_AGE (%s)", n.StreamMaxAge)
+	}
+	return nil
+}
+
+// isInterval is a validation rule for supported kline intervals.
+func isInterval(value interface{}) error {
+	s, _ := value.(string)
+	_, err := models.ParseInterval(s)
+	return err
+}
+
+// PairsByExchange returns the configured pairs keyed by exchange name.
+// Exchanges without any configured pair are omitted.
+func (cc CryptoConfig) PairsByExchange() map[string][]string {
+	all := map[string][]string{
+		models.ExchangeBinance: cc.Pairs,
+		models.ExchangeBybit:   cc.BybitPairs,
+		models.ExchangeOKX:     cc.OKXPairs,
+	}
+
+	pairs := make(map[string][]string, len(all))
+	for exchange, p := range all {
+		if len(p) > 0 {
+			pairs[exchange] = p
+		}
+	}
+	return pairs
+}
+
 // LoadConfig loads configuration from environment variables (and .env if present),
 // parses them, and stores them in the package-level Cfg variable.
 func LoadConfig() error {
@@ -143,8 +346,8 @@ func LoadConfig() error {
 
 // String returns a debug-friendly representation of the Config struct.
 func (c *Config) String() string {
-	return fmt.Sprintf("Config{AppEnv=%s,LogLevel=%s,HTTPPort=%d,SyncEnabled=%v, DB=%+v, NATS=%+v, Crypto=%+v}",
-		c.AppEnv, c.LogLevel, c.HTTPPort, c.SyncEnabled,
+	return fmt.Sprintf("Config{AppEnv=%s,LogLevel=%s,HTTPPort=%d,SyncEnabled=%v,BackfillConcurrency=%d,StreamEnabled=%v,GapHealInterval=%s,GapScanWindow=%s, DB=%+v, NATS=%+v, Crypto=%+v}",
+		c.AppEnv, c.LogLevel, c.HTTPPort, c.SyncEnabled, c.BackfillConcurrency, c.StreamEnabled, c.GapHealInterval, c.GapScanWindow,
 		c.Database, c.NATS, c.Crypto,
 	)
 }
@@ -156,12 +359,15 @@ func (d DatabaseConfig) String() string {
 
 // String returns a debug-friendly representation of NATSConfig.
 func (n NATSConfig) String() string {
-	return fmt.Sprintf("NATSConfig{URL=%s,Subject=%s,StreamName=%s,ConsumerName=%s}",
-		n.URL, n.Subject, n.StreamName, n.ConsumerName)
+	return fmt.Sprintf("NATSConfig{URL=%s,Subject=%s,Codec=%s,StreamName=%s,ConsumerName=%s,ConsumerFilter=%s,Retention=%s,MaxAge=%s,MaxBytes=%d,Storage=%s,Replicas=%d,Discard=%s,DuplicateWindow=%s,AckWait=%s,FetchBatch=%d,FetchMaxWait=%s,MaxAckPending=%d,MaxDeliver=%d,NakDelay=%s,NakMaxDelay=%s,QueryService=%t,LatestBucket=%s,DLQSubject=%s,DLQStream=%s}",
+		n.URL, n.Subject, n.Codec, n.StreamName, n.ConsumerName, n.ConsumerFilter,
+		n.StreamRetention, n.StreamMaxAge, n.StreamMaxBytes, n.StreamStorage, n.StreamReplicas, n.StreamDiscard, n.DuplicateWindow,
+		n.AckWait, n.FetchBatch, n.FetchMaxWait, n.MaxAckPending, n.MaxDeliver, n.NakDelay, n.NakMaxDelay, n.QueryService, n.LatestBucket, n.DLQSubject, n.DLQStreamName)
 }
 
 // String returns a debug-friendly representation of CryptoConfig.
 func (cc CryptoConfig) String() string {
-	return fmt.Sprintf("CryptoConfig{BinanceBaseURL=%s,KlinesPoint=%s,Pairs=%v,KlineInterval=%s,KlineLimit=%d}",
-		cc.BinanceBaseURL, cc.BinanceKlinesPoint, cc.Pairs, cc.KlineInterval, cc.KlineLimit)
+	return fmt.Sprintf("CryptoConfig{BinanceBaseURL=%s,KlinesPoint=%s,WSURL=%s,WeightLimit=%d,Pairs=%v,BybitPairs=%v,OKXPairs=%v,KlineInterval=%s,KlineLimit=%d,ScheduleIntervals=%v,SettleDelay=%s,FetchConcurrency=%d}",
+		cc.BinanceBaseURL, cc.BinanceKlinesPoint, cc.BinanceWSURL, cc.BinanceWeightLimit, cc.Pairs, cc.BybitPairs, cc.OKXPairs, cc.KlineInterval, cc.KlineLimit,
+		cc.ScheduleIntervals, cc.ScheduleSettleDelay, cc.FetchConcurrency)
 }
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"infosir/internal/db/repository"
+	"infosir/internal/jobs"
+	"infosir/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// BackfillService submits and controls backfill jobs. It is implemented by jobs.BackfillManager.
+type BackfillService interface {
+	Submit(ctx context.Context, req jobs.BackfillRequest) (models.BackfillJob, error)
+	Get(ctx context.Context, id int64) (models.BackfillJob, error)
+	List(ctx context.Context, statuses ...models.BackfillStatus) ([]models.BackfillJob, error)
+	Pause(ctx context.Context, id int64) (models.BackfillJob, error)
+	Resume(ctx context.Context, id int64) (models.BackfillJob, error)
+	Cancel(ctx context.Context, id int64) (models.BackfillJob, error)
+}
+
+// SubmitBackfillHandler serves POST /api/v1/backfills with a jobs.BackfillRequest body
+// (from/to as RFC3339) and responds 202 with the created job.
+func SubmitBackfillHandler(backfills BackfillService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req jobs.BackfillRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_argument", "invalid request payload")
+			return
+		}
+
+		job, err := backfills.Submit(r.Context(), req)
+		if err != nil {
+			writeBackfillError(w, logger, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]models.BackfillJob{"data": job})
+	}
+}
+
+// ListBackfillsHandler serves GET /api/v1/backfills, optionally filtered by ?status=.
+func ListBackfillsHandler(backfills BackfillService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var statuses []models.BackfillStatus
+		for _, s := range r.URL.Query()["status"] {
+			statuses = append(statuses, models.BackfillStatus(s))
+		}
+
+		list, err := backfills.List(r.Context(), statuses...)
+		if err != nil {
+			writeBackfillError(w, logger, err)
+			return
+		}
+		if list == nil {
+			list = []models.BackfillJob{}
+		}
+		writeJSON(w, http.StatusOK, map[string][]models.BackfillJob{"data": list})
+	}
+}
+
+// GetBackfillHandler serves GET /api/v1/backfills/{id}.
+func GetBackfillHandler(backfills BackfillService, logger *zap.Logger) http.HandlerFunc {
+	return backfillJobHandler(backfills.Get, logger)
+}
+
+// PauseBackfillHandler serves POST /api/v1/backfills/{id}/pause.
+func PauseBackfillHandler(backfills BackfillService, logger *zap.Logger) http.HandlerFunc {
+	return backfillJobHandler(backfills.Pause, logger)
+}
+
+// ResumeBackfillHandler serves POST /api/v1/backfills/{id}/resume.
+func ResumeBackfillHandler(backfills BackfillService, logger *zap.Logger) http.HandlerFunc {
+	return backfillJobHandler(backfills.Resume, logger)
+}
+
+// CancelBackfillHandler serves POST /api/v1/backfills/{id}/cancel.
+func CancelBackfillHandler(backfills BackfillService, logger *zap.Logger) http.HandlerFunc {
+	return backfillJobHandler(backfills.Cancel, logger)
+}
+
+// backfillJobHandler applies fn to the job named by the {id} path value and responds with the job.
+func backfillJobHandler(
+	fn func(ctx context.Context, id int64) (models.BackfillJob, error),
+	logger *zap.Logger,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_argument", "invalid backfill id")
+			return
+		}
+
+		job, err := fn(r.Context(), id)
+		if err != nil {
+			writeBackfillError(w, logger, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]models.BackfillJob{"data": job})
+	}
+}
+
+// writeBackfillError maps backfill errors to HTTP statuses.
+func writeBackfillError(w http.ResponseWriter, logger *zap.Logger, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrInvalidBackfill):
+		writeError(w, http.StatusBadRequest, "invalid_argument", err.Error())
+	case errors.Is(err, repository.ErrJobNotFound):
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, jobs.ErrBackfillState):
+		writeError(w, http.StatusConflict, "conflict", err.Error())
+	default:
+		logger.Error("Backfill request failed", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "internal", "backfill request failed")
+	}
+}
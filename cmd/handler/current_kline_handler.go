@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"infosir/internal/models"
+	natsinfosir "infosir/pkg/nats"
+
+	"go.uber.org/zap"
+)
+
+// CurrentKlineReader reads the latest candle of a series from the Key-Value bucket.
+type CurrentKlineReader interface {
+	Get(ctx context.Context, exchange, symbol, interval string) (models.Kline, error)
+}
+
+// CurrentKlineHandler serves GET /api/v1/klines/current?exchange=&market=&symbol=&interval=: the
+// latest candle ingested for the series, possibly still open, straight from the Key-Value bucket and
+// without touching the database. exchange defaults to binance and interval to "1m".
+//
+// Bucket keys carry no market, so there is one current candle per exchange, symbol and interval.
+// market is optional; if given and the stored candle belongs to another market, the response is 404.
+func CurrentKlineHandler(latest CurrentKlineReader, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		inst, err := parseInstrument(q.Get("exchange"), q.Get("market"), q.Get("symbol"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_argument", err.Error())
+			return
+		}
+		interval := models.Interval1m
+		if raw := q.Get("interval"); raw != "" {
+			if interval, err = models.ParseInterval(raw); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid_argument", err.Error())
+				return
+			}
+		}
+
+		k, err := latest.Get(r.Context(), inst.Exchange, inst.Symbol, interval.String())
+		if err == nil && q.Get("market") != "" && k.Market != inst.Market {
+			err = natsinfosir.ErrNoLatestKline
+		}
+		if errors.Is(err, natsinfosir.ErrNoLatestKline) {
+			writeError(w, http.StatusNotFound, "not_found", "no current kline for "+inst.String()+" "+interval.String())
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to read current kline", zap.Stringer("instrument", inst), zap.Stringer("interval", interval), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal", "failed to read current kline")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]models.Kline{"data": k})
+	}
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+
+	"infosir/internal/jobs"
+)
+
+// GapStatusReader provides the latest gap scan results and healing progress.
+type GapStatusReader interface {
+	Status() jobs.GapStatus
+}
+
+// GapsHandler serves GET /api/v1/gaps: the gaps found by the latest scan and the heal progress.
+func GapsHandler(healer GapStatusReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, healer.Status())
+	}
+}
@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"infosir/internal/db/repository"
+	"infosir/internal/models"
+	"infosir/pkg/crypto"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultPageLimit is the page size used when the request doesn't specify one.
+	defaultPageLimit = 500
+	// maxPageLimit caps the page size of a single request.
+	maxPageLimit = 1000
+)
+
+// symbolPattern restricts symbols to what exchanges actually use, e.g. "BTCUSDT" or "BTC-USDT-SWAP".
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9-]{2,32}$`)
+
+// KlineReader is the read side of the kline repository used by the HTTP API.
+type KlineReader interface {
+	// FindLast retrieves the most recent kline of the instrument.
+	FindLast(ctx context.Context, inst models.Instrument) (models.Kline, error)
+	// FindAggregated retrieves klines of the given interval within [from, to], ascending.
+	FindAggregated(
+		ctx context.Context,
+		inst models.Instrument,
+		interval models.Interval,
+		from, to time.Time,
+		limit int,
+	) ([]models.Kline, error)
+}
+
+// klinesPage is the JSON body of GET /api/v1/klines.
+type klinesPage struct {
+	Data []models.Kline `json:"data"`
+	// NextCursor is set when more klines are available; pass it as ?cursor= to get the next page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// KlinesHandler serves GET /api/v1/klines?exchange=&market=&symbol=&interval=&from=&to=&limit=&cursor=&format=
+//
+//   - exchange defaults to "binance", market to the market configured for that exchange.
+//   - interval defaults to "1m"; coarser intervals are aggregated from stored 1m klines.
+//   - from/to accept RFC3339 or unix milliseconds; to defaults to now, from to 'limit' candles before to.
+//   - limit defaults to 500 and is capped at 1000.
+//   - format is "json" (default) or "csv"; an "Accept: text/csv" header works as well.
+//
+// Results are ascending. If more klines are available, the response carries a cursor (in the JSON
+// body and in the X-Next-Cursor header) which continues right after the last returned kline.
+func KlinesHandler(repo KlineReader, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseKlinesQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_argument", err.Error())
+			return
+		}
+
+		page, err := readKlinesPage(r.Context(), repo, query)
+		if err != nil {
+			logger.Error("Failed to read klines", zap.Stringer("instrument", query.inst), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal", "failed to read klines")
+			return
+		}
+		if page.NextCursor != "" {
+			w.Header().Set("X-Next-Cursor", page.NextCursor)
+		}
+
+		if wantsCSV(r) {
+			writeKlinesCSV(w, page.Data)
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+// klinesQuery is a validated klines request.
+type klinesQuery struct {
+	inst     models.Instrument
+	interval models.Interval
+	from, to time.Time
+	limit    int
+}
+
+// parseKlinesQuery validates the parameters of a klines request and applies the defaults
+// documented on KlinesHandler.
+func parseKlinesQuery(q url.Values) (klinesQuery, error) {
+	inst, err := parseInstrument(q.Get("exchange"), q.Get("market"), q.Get("symbol"))
+	if err != nil {
+		return klinesQuery{}, err
+	}
+
+	interval := models.Interval1m
+	if raw := q.Get("interval"); raw != "" {
+		if interval, err = models.ParseInterval(raw); err != nil {
+			return klinesQuery{}, err
+		}
+	}
+
+	limit := defaultPageLimit
+	if raw := q.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return klinesQuery{}, errors.New("limit must be an integer between 1 and 1000")
+		}
+	}
+
+	to := time.Now()
+	if raw := q.Get("to"); raw != "" {
+		if to, err = parseTime(raw); err != nil {
+			return klinesQuery{}, errors.New("invalid 'to': " + err.Error())
+		}
+	}
+	from := to.Add(-time.Duration(limit) * interval.Duration())
+	if raw := q.Get("from"); raw != "" {
+		if from, err = parseTime(raw); err != nil {
+			return klinesQuery{}, errors.New("invalid 'from': " + err.Error())
+		}
+	}
+	if raw := q.Get("cursor"); raw != "" {
+		if from, err = decodeCursor(raw); err != nil {
+			return klinesQuery{}, errors.New("invalid cursor")
+		}
+	}
+	if from.After(to) {
+		return klinesQuery{}, errors.New("'from' must not be after 'to'")
+	}
+
+	return klinesQuery{inst: inst, interval: interval, from: from, to: to, limit: limit}, nil
+}
+
+// readKlinesPage reads one page of klines. It fetches one extra kline to find out whether there
+// is a next page, and if so sets the cursor pointing at it.
+func readKlinesPage(ctx context.Context, repo KlineReader, query klinesQuery) (klinesPage, error) {
+	klines, err := repo.FindAggregated(ctx, query.inst, query.interval, query.from, query.to, query.limit+1)
+	if err != nil {
+		return klinesPage{}, err
+	}
+
+	page := klinesPage{Data: klines}
+	if len(klines) > query.limit {
+		page.Data = klines[:query.limit]
+		page.NextCursor = encodeCursor(klines[query.limit].Time)
+	}
+	return page, nil
+}
+
+// LatestKlineHandler serves GET /api/v1/klines/latest?exchange=&market=&symbol=
+// and returns the most recent stored kline as {"data": {...}}.
+func LatestKlineHandler(repo KlineReader, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		inst, err := parseInstrument(q.Get("exchange"), q.Get("market"), q.Get("symbol"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_argument", err.Error())
+			return
+		}
+
+		k, err := repo.FindLast(r.Context(), inst)
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not_found", "no klines stored for "+inst.String())
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to read latest kline", zap.Stringer("instrument", inst), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "internal", "failed to read latest kline")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]models.Kline{"data": k})
+	}
+}
+
+// parseInstrument validates the instrument query parameters and applies the defaults:
+// Binance as exchange and the configured market of the exchange.
+func parseInstrument(exchange, market, symbol string) (models.Instrument, error) {
+	if exchange == "" {
+		exchange = models.ExchangeBinance
+	}
+	switch exchange {
+	case models.ExchangeBinance, models.ExchangeBybit, models.ExchangeOKX:
+	default:
+		return models.Instrument{}, errors.New("unknown exchange " + strconv.Quote(exchange))
+	}
+
+	symbol = strings.ToUpper(symbol)
+	if !symbolPattern.MatchString(symbol) {
+		return models.Instrument{}, errors.New("missing or invalid 'symbol'")
+	}
+
+	inst := crypto.InstrumentFor(exchange, symbol)
+	switch market {
+	case "":
+	case models.MarketSpot, models.MarketFutures:
+		inst.Market = market
+	default:
+		return models.Instrument{}, errors.New("unknown market " + strconv.Quote(market))
+	}
+	return inst, nil
+}
+
+// parseTime accepts RFC3339 timestamps and unix milliseconds.
+func parseTime(raw string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// encodeCursor returns an opaque pagination cursor pointing at the given open time.
+func encodeCursor(t time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixMilli(), 10)))
+}
+
+// decodeCursor is the inverse of encodeCursor.
+func decodeCursor(cursor string) (time.Time, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// wantsCSV reports whether the client asked for CSV via ?format=csv or the Accept header.
+func wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+// writeKlinesCSV writes klines as CSV with a header row. Times are RFC3339 with milliseconds.
+func writeKlinesCSV(w http.ResponseWriter, klines []models.Kline) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{
+		"time", "close_time", "is_closed", "exchange", "market", "symbol", "open", "high", "low", "close",
+		"volume", "quote_volume", "trades", "taker_buy_base_volume", "taker_buy_quote_volume",
+	})
+	for _, k := range klines {
+		_ = cw.Write([]string{
+			k.Time.UTC().Format(time.RFC3339Nano),
+			k.CloseTime.UTC().Format(time.RFC3339Nano),
+			strconv.FormatBool(k.IsClosed),
+			k.Exchange, k.Market, k.Symbol,
+			k.OpenPrice.String(), k.HighPrice.String(), k.LowPrice.String(), k.ClosePrice.String(),
+			k.Volume.String(), k.QuoteVolume.String(),
+			strconv.FormatInt(k.Trades, 10),
+			k.TakerBuyBaseVolume.String(), k.TakerBuyQuoteVolume.String(),
+		})
+	}
+	cw.Flush()
+}
+
+// errorBody is the consistent error body of all API endpoints:
+//
+//	{"error": {"code": "invalid_argument", "message": "..."}}
+type errorBody struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// writeError writes an errorBody with the given status.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	var body errorBody
+	body.Error.Code = code
+	body.Error.Message = message
+	writeJSON(w, status, body)
+}
+
+// writeJSON writes v as JSON with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
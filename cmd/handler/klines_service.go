@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"infosir/internal/db/repository"
+	"infosir/internal/models"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"go.uber.org/zap"
+)
+
+const (
+	// KlineServiceName is the name the query service registers with NATS micro discovery.
+	KlineServiceName = "infosir-klines"
+	// KlineServiceVersion is the semantic version of the query service API.
+	KlineServiceVersion = "1.0.0"
+
+	// queryTimeout bounds the repository work of one request.
+	queryTimeout = 10 * time.Second
+)
+
+// KlineQueryStore is the read side of the kline repository used by the NATS query service.
+type KlineQueryStore interface {
+	KlineReader
+	// FindInstruments lists the instruments with stored klines, of one exchange or all ("").
+	FindInstruments(ctx context.Context, exchange string) ([]models.Instrument, error)
+}
+
+// KlineQueryRequest is the request of kline.query. The fields mean the same as the query
+// parameters of GET /api/v1/klines; from and to accept RFC3339 or unix milliseconds.
+type KlineQueryRequest struct {
+	Exchange string `json:"exchange,omitempty"`
+	Market   string `json:"market,omitempty"`
+	Symbol   string `json:"symbol"`
+	Interval string `json:"interval,omitempty"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+	Cursor   string `json:"cursor,omitempty"`
+}
+
+// KlineLatestRequest is the request of kline.latest.
+type KlineLatestRequest struct {
+	Exchange string `json:"exchange,omitempty"`
+	Market   string `json:"market,omitempty"`
+	Symbol   string `json:"symbol"`
+}
+
+// KlineSymbolsRequest is the request of kline.symbols; an empty body lists every exchange.
+type KlineSymbolsRequest struct {
+	Exchange string `json:"exchange,omitempty"`
+}
+
+// StartKlineQueryService registers the NATS micro service answering kline requests:
+//
+//   - kline.query   KlineQueryRequest   -> {"data": [...], "next_cursor": "..."}
+//   - kline.latest  KlineLatestRequest  -> {"data": {...}}
+//   - kline.symbols KlineSymbolsRequest -> {"data": [{"exchange", "market", "symbol"}]}
+//
+// Failed requests get the standard micro error headers (Nats-Service-Error-Code with an HTTP-like
+// status, Nats-Service-Error with the message) and the same error body as the HTTP API.
+// The service stops when ctx is cancelled.
+func StartKlineQueryService(ctx context.Context, nc *nats.Conn, repo KlineQueryStore, logger *zap.Logger) (micro.Service, error) {
+	svc, err := micro.AddService(nc, micro.Config{
+		Name:        KlineServiceName,
+		Version:     KlineServiceVersion,
+		Description: "Stored klines over NATS request/reply",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	group := svc.AddGroup("kline")
+	for name, handler := range map[string]micro.Handler{
+		"query":   KlineQueryEndpoint(ctx, repo, logger),
+		"latest":  KlineLatestEndpoint(ctx, repo, logger),
+		"symbols": KlineSymbolsEndpoint(ctx, repo, logger),
+	} {
+		if err := group.AddEndpoint(name, handler); err != nil {
+			_ = svc.Stop()
+			return nil, err
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = svc.Stop()
+	}()
+	return svc, nil
+}
+
+// KlineQueryEndpoint handles kline.query: a page of stored klines, as GET /api/v1/klines.
+func KlineQueryEndpoint(ctx context.Context, repo KlineReader, logger *zap.Logger) micro.Handler {
+	return micro.ContextHandler(ctx, func(ctx context.Context, req micro.Request) {
+		var body KlineQueryRequest
+		if !decodeServiceRequest(req, &body) {
+			return
+		}
+
+		query, err := parseKlinesQuery(body.values())
+		if err != nil {
+			respondServiceError(req, http.StatusBadRequest, "invalid_argument", err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+		page, err := readKlinesPage(ctx, repo, query)
+		if err != nil {
+			logger.Error("Failed to read klines", zap.Stringer("instrument", query.inst), zap.Error(err))
+			respondServiceError(req, http.StatusInternalServerError, "internal", "failed to read klines")
+			return
+		}
+		_ = req.RespondJSON(page)
+	})
+}
+
+// KlineLatestEndpoint handles kline.latest: the most recent stored kline of an instrument.
+func KlineLatestEndpoint(ctx context.Context, repo KlineReader, logger *zap.Logger) micro.Handler {
+	return micro.ContextHandler(ctx, func(ctx context.Context, req micro.Request) {
+		var body KlineLatestRequest
+		if !decodeServiceRequest(req, &body) {
+			return
+		}
+
+		inst, err := parseInstrument(body.Exchange, body.Market, body.Symbol)
+		if err != nil {
+			respondServiceError(req, http.StatusBadRequest, "invalid_argument", err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+		k, err := repo.FindLast(ctx, inst)
+		if errors.Is(err, repository.ErrNotFound) {
+			respondServiceError(req, http.StatusNotFound, "not_found", "no klines stored for "+inst.String())
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to read latest kline", zap.Stringer("instrument", inst), zap.Error(err))
+			respondServiceError(req, http.StatusInternalServerError, "internal", "failed to read latest kline")
+			return
+		}
+		_ = req.RespondJSON(map[string]models.Kline{"data": k})
+	})
+}
+
+// KlineSymbolsEndpoint handles kline.symbols: the instruments with stored klines.
+func KlineSymbolsEndpoint(ctx context.Context, repo KlineQueryStore, logger *zap.Logger) micro.Handler {
+	return micro.ContextHandler(ctx, func(ctx context.Context, req micro.Request) {
+		var body KlineSymbolsRequest
+		if !decodeServiceRequest(req, &body) {
+			return
+		}
+
+		switch body.Exchange {
+		case "", models.ExchangeBinance, models.ExchangeBybit, models.ExchangeOKX:
+		default:
+			respondServiceError(req, http.StatusBadRequest, "invalid_argument", "unknown exchange "+strconv.Quote(body.Exchange))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+		instruments, err := repo.FindInstruments(ctx, body.Exchange)
+		if err != nil {
+			logger.Error("Failed to list instruments", zap.String("exchange", body.Exchange), zap.Error(err))
+			respondServiceError(req, http.StatusInternalServerError, "internal", "failed to list instruments")
+			return
+		}
+		if instruments == nil {
+			instruments = []models.Instrument{}
+		}
+		_ = req.RespondJSON(map[string][]models.Instrument{"data": instruments})
+	})
+}
+
+// values returns the request as the query parameters parseKlinesQuery understands.
+func (r KlineQueryRequest) values() url.Values {
+	q := url.Values{}
+	for key, value := range map[string]string{
+		"exchange": r.Exchange,
+		"market":   r.Market,
+		"symbol":   r.Symbol,
+		"interval": r.Interval,
+		"from":     r.From,
+		"to":       r.To,
+		"cursor":   r.Cursor,
+	} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	if r.Limit != 0 {
+		q.Set("limit", strconv.Itoa(r.Limit))
+	}
+	return q
+}
+
+// decodeServiceRequest unmarshals the JSON request body into v; an empty body leaves v empty.
+// On failure it responds with an invalid_argument error and returns false.
+func decodeServiceRequest(req micro.Request, v interface{}) bool {
+	if len(req.Data()) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(req.Data(), v); err != nil {
+		respondServiceError(req, http.StatusBadRequest, "invalid_argument", "invalid JSON request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// respondServiceError replies with the micro error headers and the errorBody of the HTTP API.
+func respondServiceError(req micro.Request, status int, code, message string) {
+	var body errorBody
+	body.Error.Code = code
+	body.Error.Message = message
+	data, _ := json.Marshal(body)
+	_ = req.Error(strconv.Itoa(status), message, data)
+}
@@ -3,69 +3,125 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
+	"time"
 
+	"infosir/internal/models"
 	"infosir/internal/srv"
+	"infosir/internal/utils"
+	"infosir/pkg/crypto"
 
 	"go.uber.org/zap"
 )
 
 // OrchestratorRequest описывает входные параметры запроса от оркестратора
 type OrchestratorRequest struct {
-	Pair   string `json:"pair"`
-	Time   string `json:"time"`
-	Klines int64  `json:"klines"`
+	// Exchange is optional and defaults to Binance.
+	Exchange string `json:"exchange"`
+	// Pair must be one of the pairs configured for the exchange.
+	Pair string `json:"pair"`
+	// Time is the kline interval in Binance notation, e.g. "1m" or "1h".
+	Time string `json:"time"`
+	// Klines is the number of klines to fetch; it is capped at the exchange's per-request maximum.
+	// It may be omitted when both Start and End are given.
+	Klines int64 `json:"klines"`
+	// Start and End optionally request an exact window of open times (RFC3339).
+	Start time.Time `json:"start,omitempty"`
+	End   time.Time `json:"end,omitempty"`
 }
 
-// OrchestratorRequest holds the request payload from an orchestrator
-// for fetching & publishing klines.
+// OrchestratorResponse is returned after the klines were fetched and published.
+type OrchestratorResponse struct {
+	Status  string            `json:"status"`
+	Klines  []models.Kline    `json:"klines"`
+	Publish models.PublishAck `json:"publish"`
+}
+
+// OrchestratorHandler fetches klines on behalf of an orchestrator, publishes them to JetStream
+// and returns both the klines and the publish acknowledgement (stream and sequence).
 func OrchestratorHandler(service srv.InfoSirService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only POST is allowed")
 			return
 		}
 
 		var req OrchestratorRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			logger.Error("Failed to decode orchestrator request", zap.Error(err))
-			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "invalid_argument", "invalid request payload")
 			return
 		}
 
-		// Простейшая валидация входных данных
-		if req.Pair == "" || req.Klines <= 0 {
-			logger.Error("Invalid arguments in orchestrator request",
+		if req.Exchange == "" {
+			req.Exchange = models.ExchangeBinance
+		}
+
+		// Валидация входных данных
+		if msg := validateOrchestratorRequest(&req); msg != "" {
+			logger.Warn("Invalid arguments in orchestrator request",
+				zap.String("exchange", req.Exchange),
 				zap.String("pair", req.Pair),
-				zap.Int64("klines", req.Klines))
-			http.Error(w, "Invalid arguments", http.StatusBadRequest)
+				zap.String("time", req.Time),
+				zap.Int64("klines", req.Klines),
+				zap.String("reason", msg))
+			writeError(w, http.StatusBadRequest, "invalid_argument", msg)
 			return
 		}
 
-		// Если нет реального сервиса — временно пропускаем
-		if service != nil {
-			// Предположим, что service.GetKlines() вернёт набор свечей (interface{} пока что)
-			klines, err := service.GetKlines(r.Context(), req.Pair, req.Time, req.Klines)
-			if err != nil {
-				logger.Error("Failed to get klines", zap.Error(err))
-				http.Error(w, "Failed to fetch klines", http.StatusInternalServerError)
-				return
-			}
-
-			// Затем публикуем результат в NATS
-			if err := service.PublishKlinesJS(r.Context(), klines); err != nil {
-				logger.Error("Failed to publish klines", zap.Error(err))
-				http.Error(w, "Failed to publish klines", http.StatusInternalServerError)
-				return
-			}
+		var (
+			klines []models.Kline
+			err    error
+		)
+		if req.Start.IsZero() && req.End.IsZero() {
+			klines, err = service.GetKlines(r.Context(), req.Exchange, req.Pair, req.Time, req.Klines)
 		} else {
-			logger.Warn("OrchestratorHandler called without a real InfoSirService implementation")
+			klines, err = service.GetKlinesRange(r.Context(), req.Exchange, req.Pair, req.Time, req.Start, req.End, req.Klines)
+		}
+		if err != nil {
+			logger.Error("Failed to get klines", zap.Error(err))
+			writeError(w, http.StatusBadGateway, "exchange_error", "failed to fetch klines")
+			return
+		}
+
+		// Затем публикуем результат в NATS
+		ack, err := service.PublishKlinesJS(r.Context(), klines)
+		if err != nil {
+			logger.Error("Failed to publish klines", zap.Error(err))
+			writeError(w, http.StatusInternalServerError, "publish_failed", "failed to publish klines")
+			return
 		}
 
-		// Всё прошло успешно — отправляем статус 200
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		// Всё прошло успешно — отдаём свечи и подтверждение публикации
+		writeJSON(w, http.StatusOK, OrchestratorResponse{Status: "ok", Klines: klines, Publish: ack})
+	}
+}
+
+// validateOrchestratorRequest checks the request against the configured pairs and the supported
+// intervals and caps Klines at the exchange limit. It returns a non-empty message if the request is invalid.
+func validateOrchestratorRequest(req *OrchestratorRequest) string {
+	pairs, ok := utils.GetConfig().Crypto.PairsByExchange()[req.Exchange]
+	if !ok || len(pairs) == 0 {
+		return "exchange " + req.Exchange + " is not configured"
+	}
+	if !slices.Contains(pairs, req.Pair) {
+		return "pair " + req.Pair + " is not configured for " + req.Exchange
+	}
+	if _, err := models.ParseInterval(req.Time); err != nil {
+		return err.Error()
+	}
+
+	window := !req.Start.IsZero() || !req.End.IsZero()
+	if !req.Start.IsZero() && !req.End.IsZero() && req.Start.After(req.End) {
+		return "start must not be after end"
+	}
 
-		resp := map[string]string{"status": "ok"}
-		_ = json.NewEncoder(w).Encode(resp)
+	maxLimit := crypto.MaxKlinesLimit(req.Exchange)
+	switch {
+	case req.Klines < 0, req.Klines == 0 && !window:
+		return "klines must be positive"
+	case req.Klines == 0, req.Klines > maxLimit:
+		req.Klines = maxLimit
 	}
+	return ""
 }
@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+
+	"infosir/internal/models"
+)
+
+// PublishStatsReader provides the publish counters of the NATS client.
+type PublishStatsReader interface {
+	Stats() models.PublishStats
+}
+
+// PublishStatsHandler serves GET /api/v1/publish/stats: how many kline messages were stored by
+// the stream and how many were dropped as duplicates since startup.
+func PublishStatsHandler(stats PublishStatsReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, stats.Stats())
+	}
+}
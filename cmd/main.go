@@ -11,6 +11,7 @@ import (
 	"go.uber.org/zap"
 
 	"infosir/cmd/config"
+	"infosir/cmd/handler"
 	"infosir/internal/db"
 	"infosir/internal/db/repository"
 	"infosir/internal/jobs"
@@ -40,12 +41,21 @@ func main() {
 		zap.String("environment", config.Cfg.AppEnv),
 		zap.String("logLevel", config.Cfg.LogLevel),
 	)
+
+	// 4. Run a maintenance subcommand, e.g. "infosir dlq-replay", instead of the service
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, os.Args[1], os.Args[2:]); err != nil {
+			utils.Logger.Fatal("Command failed", zap.String("command", os.Args[1]), zap.Error(err))
+		}
+		return
+	}
+
+	// 5. Initialize Database with migrations
 	files, _ := os.ReadDir("/app/migrations")
 	for _, f := range files {
 		fmt.Printf("Found migration file: %s\n", f.Name())
 	}
 
-	// 4. Initialize Database with migrations
 	dbPool, err := db.InitDatabase()
 	if err != nil {
 		utils.Logger.Fatal("Could not initialize DB with migrations", zap.Error(err))
@@ -56,10 +66,11 @@ func main() {
 		zap.String("dbName", config.Cfg.Database.Name),
 	)
 
-	// 5. Initialize the repository
+	// 6. Initialize the repositories
 	klineRepo := repository.NewKlineRepository(dbPool)
+	backfillRepo := repository.NewBackfillRepository(dbPool)
 
-	// 6. Initialize NATS + JetStream
+	// 7. Initialize NATS + JetStream
 	nc, js, err := natsinfosir.InitNATSJetStream()
 	if err != nil {
 		utils.Logger.Fatal("Failed to init NATS JetStream", zap.Error(err))
@@ -68,37 +79,74 @@ func main() {
 
 	utils.Logger.Info("Connected to NATS JetStream",
 		zap.String("stream", config.Cfg.NATS.StreamName),
-		zap.String("subject", config.Cfg.NATS.Subject),
+		zap.String("subjectPrefix", config.Cfg.NATS.Subject),
 	)
 
-	// 7. Start the consumer that reads from JetStream and writes to DB
+	// 8. Start the consumer that reads from JetStream and writes to DB
 	if err := natsinfosir.StartJetStreamConsumer(ctx, js, klineRepo); err != nil {
 		utils.Logger.Fatal("Failed to start JetStream consumer", zap.Error(err))
 	}
 
-	// 8. Create real binance client & nats client
-	binanceClient := crypto.NewBinanceClient()
-	natsClient := natsinfosir.NewNatsJetStreamClient(js)
+	// Answer kline requests from other services over NATS
+	if config.Cfg.NATS.QueryService {
+		if _, err := handler.StartKlineQueryService(ctx, nc, klineRepo, utils.Logger); err != nil {
+			utils.Logger.Fatal("Failed to start NATS kline query service", zap.Error(err))
+		}
+		utils.Logger.Info("NATS kline query service started", zap.String("service", handler.KlineServiceName))
+	}
+
+	// 9. Create the exchange clients registry & nats client
+	exchanges := crypto.NewExchangeRegistry()
+	natsClient, err := natsinfosir.NewNatsJetStreamClient(js)
+	if err != nil {
+		utils.Logger.Fatal("Failed to create NATS client", zap.Error(err))
+	}
 
-	// 9. Create the InfoSir service
-	infoSirService := srv.NewInfoSirService(binanceClient, natsClient)
+	// 10. Create the InfoSir service
+	infoSirService := srv.NewInfoSirService(exchanges, natsClient)
 
-	// 10. Possibly start the historical sync if enabled
+	// 11. Resume unfinished backfills and possibly submit the historical sync if enabled
+	backfills := jobs.NewBackfillManager(backfillRepo, klineRepo, exchanges)
+	if err := backfills.Start(ctx); err != nil {
+		utils.Logger.Error("Failed to resume backfill jobs", zap.Error(err))
+	}
 	if config.Cfg.SyncEnabled {
-		go jobs.RunHistoricalSync(ctx, klineRepo, binanceClient)
+		go jobs.RunHistoricalSync(ctx, klineRepo, backfills)
 	}
 
-	// 11. Start scheduled job to fetch/publish klines periodically
-	go jobs.RunScheduledRequests(ctx, infoSirService, time.Minute)
+	// Periodically scan for holes in the stored history and re-fetch them
+	gapHealer := jobs.NewGapHealer(klineRepo, backfillRepo, exchanges)
+	if config.Cfg.GapHealInterval > 0 {
+		go gapHealer.Run(ctx, config.Cfg.GapHealInterval)
+	}
 
-	// 12. Start the HTTP server
-	httpSrv := startHTTPServer(infoSirService)
+	// Keep the latest candle of every series in a Key-Value bucket
+	var latest *natsinfosir.LatestKlineStore
+	var latestWriter jobs.LatestKlineWriter
+	if config.Cfg.NATS.LatestBucket != "" {
+		if latest, err = natsinfosir.NewLatestKlineStore(js); err != nil {
+			utils.Logger.Fatal("Failed to open latest klines bucket", zap.Error(err))
+		}
+		latestWriter = latest
+		utils.Logger.Info("Latest klines bucket ready", zap.String("bucket", config.Cfg.NATS.LatestBucket))
+	}
+
+	// 12. Start live ingestion: either the WebSocket stream or the scheduled REST polling
+	if config.Cfg.StreamEnabled {
+		stream := crypto.NewBinanceStreamClient(config.Cfg.Crypto.Pairs, config.Cfg.Crypto.KlineInterval)
+		go jobs.RunKlineStream(ctx, infoSirService, stream, latestWriter)
+	} else {
+		go jobs.RunScheduledRequests(ctx, infoSirService, latestWriter)
+	}
+
+	// 13. Start the HTTP server
+	httpSrv := startHTTPServer(infoSirService, natsClient, klineRepo, latest, gapHealer, backfills)
 
 	utils.Logger.Info("HTTP server started",
 		zap.Int("port", config.Cfg.HTTPPort),
 	)
 
-	// 13. Wait for interrupt signals to shut down gracefully
+	// 14. Wait for interrupt signals to shut down gracefully
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt)
 	<-stopChan
@@ -106,18 +154,28 @@ func main() {
 	utils.Logger.Info("Shutting down gracefully...")
 	cancel() // Cancel the main context
 
-	// 14. Attempt graceful shutdown of HTTP server
+	// 15. Attempt graceful shutdown of HTTP server
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
 	if err := httpSrv.Shutdown(shutdownCtx); err != nil && err != http.ErrServerClosed {
 		utils.Logger.Error("Error shutting down HTTP server", zap.Error(err))
 	}
 
+	// Running backfills stop at their last checkpoint and resume on the next start
+	backfills.Wait()
+
 	utils.Logger.Info("Service stopped. Goodbye!")
 }
 
 // startHTTPServer sets up the necessary endpoints, wraps them in a mux, and starts listening.
-func startHTTPServer(service srv.InfoSirService) *http.Server {
+func startHTTPServer(
+	service srv.InfoSirService,
+	publishStats handler.PublishStatsReader,
+	klineRepo *repository.KlineRepository,
+	latest *natsinfosir.LatestKlineStore,
+	gapHealer *jobs.GapHealer,
+	backfills *jobs.BackfillManager,
+) *http.Server {
 	mux := http.NewServeMux()
 
 	// Example healthcheck
@@ -126,8 +184,25 @@ func startHTTPServer(service srv.InfoSirService) *http.Server {
 		_, _ = w.Write([]byte("OK\n"))
 	})
 
-	// TODO: Register the orchestrator route if needed:
-	// mux.Handle("/orchestrator/fetch", handler.OrchestratorHandler(service, util.Logger))
+	// Read API for stored klines
+	mux.Handle("GET /api/v1/klines", handler.KlinesHandler(klineRepo, utils.Logger))
+	mux.Handle("GET /api/v1/klines/latest", handler.LatestKlineHandler(klineRepo, utils.Logger))
+	if latest != nil {
+		mux.Handle("GET /api/v1/klines/current", handler.CurrentKlineHandler(latest, utils.Logger))
+	}
+	mux.Handle("GET /api/v1/gaps", handler.GapsHandler(gapHealer))
+	mux.Handle("GET /api/v1/publish/stats", handler.PublishStatsHandler(publishStats))
+
+	// Backfill jobs
+	mux.Handle("POST /api/v1/backfills", handler.SubmitBackfillHandler(backfills, utils.Logger))
+	mux.Handle("GET /api/v1/backfills", handler.ListBackfillsHandler(backfills, utils.Logger))
+	mux.Handle("GET /api/v1/backfills/{id}", handler.GetBackfillHandler(backfills, utils.Logger))
+	mux.Handle("POST /api/v1/backfills/{id}/pause", handler.PauseBackfillHandler(backfills, utils.Logger))
+	mux.Handle("POST /api/v1/backfills/{id}/resume", handler.ResumeBackfillHandler(backfills, utils.Logger))
+	mux.Handle("POST /api/v1/backfills/{id}/cancel", handler.CancelBackfillHandler(backfills, utils.Logger))
+
+	// On-demand fetch & publish for orchestrators
+	mux.Handle("POST /orchestrator/fetch", handler.OrchestratorHandler(service, utils.Logger))
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.Cfg.HTTPPort),
@@ -0,0 +1,44 @@
+-- 0003_add_exchange_market.up.sql
+-- Adds the exchange/market dimension to futures_klines, so that the same symbol from several
+-- venues (or spot vs futures) no longer collides. Existing rows are back-filled as Binance futures.
+
+BEGIN;
+
+-- The continuous aggregates select from futures_klines and group by symbol only;
+-- they are dropped here and recreated with the new dimensions in 0005.
+DROP MATERIALIZED VIEW IF EXISTS klines_15m;
+DROP MATERIALIZED VIEW IF EXISTS klines_30m;
+DROP MATERIALIZED VIEW IF EXISTS klines_1h;
+DROP MATERIALIZED VIEW IF EXISTS klines_4h;
+DROP MATERIALIZED VIEW IF EXISTS klines_1d;
+
+-- The primary key can't be changed on compressed chunks, so decompress everything first.
+SELECT remove_compression_policy('futures_klines', if_exists => TRUE);
+SELECT decompress_chunk(c, if_compressed => TRUE) FROM show_chunks('futures_klines') c;
+ALTER TABLE futures_klines SET (timescaledb.compress = false);
+
+ALTER TABLE futures_klines
+    ADD COLUMN IF NOT EXISTS exchange TEXT NOT NULL DEFAULT 'binance',
+    ADD COLUMN IF NOT EXISTS market TEXT NOT NULL DEFAULT 'futures';
+
+-- New rows must always state where they come from.
+ALTER TABLE futures_klines
+    ALTER COLUMN exchange DROP DEFAULT,
+    ALTER COLUMN market DROP DEFAULT;
+
+ALTER TABLE futures_klines DROP CONSTRAINT IF EXISTS futures_klines_pkey;
+ALTER TABLE futures_klines ADD PRIMARY KEY (exchange, market, symbol, time);
+
+DROP INDEX IF EXISTS idx_futures_klines_symbol;
+CREATE INDEX IF NOT EXISTS idx_futures_klines_instrument ON futures_klines(exchange, market, symbol, time DESC);
+
+ALTER TABLE futures_klines
+    SET (
+    timescaledb.compress,
+    timescaledb.compress_segmentby = 'exchange, market, symbol',
+    timescaledb.compress_orderby = 'time DESC'
+    );
+
+SELECT add_compression_policy('futures_klines', INTERVAL '30 days');
+
+COMMIT;
@@ -0,0 +1,32 @@
+-- 0004_numeric_prices.up.sql
+-- Switches prices and volumes from DOUBLE PRECISION to exact NUMERIC values.
+
+BEGIN;
+
+-- Column types can't be changed while continuous aggregates depend on them: they are still
+-- dropped from 0003 and get recreated on top of the NUMERIC columns in 0005.
+-- Column types can't be changed on compressed chunks either.
+SELECT remove_compression_policy('futures_klines', if_exists => TRUE);
+SELECT decompress_chunk(c, if_compressed => TRUE) FROM show_chunks('futures_klines') c;
+ALTER TABLE futures_klines SET (timescaledb.compress = false);
+
+ALTER TABLE futures_klines
+    ALTER COLUMN open_price TYPE NUMERIC,
+    ALTER COLUMN high_price TYPE NUMERIC,
+    ALTER COLUMN low_price TYPE NUMERIC,
+    ALTER COLUMN close_price TYPE NUMERIC,
+    ALTER COLUMN volume TYPE NUMERIC,
+    ALTER COLUMN quote_volume TYPE NUMERIC,
+    ALTER COLUMN taker_buy_base_volume TYPE NUMERIC,
+    ALTER COLUMN taker_buy_quote_volume TYPE NUMERIC;
+
+ALTER TABLE futures_klines
+    SET (
+    timescaledb.compress,
+    timescaledb.compress_segmentby = 'exchange, market, symbol',
+    timescaledb.compress_orderby = 'time DESC'
+    );
+
+SELECT add_compression_policy('futures_klines', INTERVAL '30 days');
+
+COMMIT;
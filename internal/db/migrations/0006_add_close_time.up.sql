@@ -0,0 +1,33 @@
+-- 0006_add_close_time.up.sql
+-- Tracks the close time of every candle and whether it is final. Open candles are upserted
+-- until they close. All existing rows were stored from 1m klines and are final.
+
+BEGIN;
+
+-- Existing compressed chunks must be decompressed to back-fill the new columns.
+SELECT remove_compression_policy('futures_klines', if_exists => TRUE);
+SELECT decompress_chunk(c, if_compressed => TRUE) FROM show_chunks('futures_klines') c;
+ALTER TABLE futures_klines SET (timescaledb.compress = false);
+
+ALTER TABLE futures_klines
+    ADD COLUMN IF NOT EXISTS close_time TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS is_closed BOOLEAN NOT NULL DEFAULT TRUE;
+
+UPDATE futures_klines
+SET close_time = time + INTERVAL '1 minute' - INTERVAL '1 millisecond'
+WHERE close_time IS NULL;
+
+ALTER TABLE futures_klines
+    ALTER COLUMN close_time SET NOT NULL,
+    ALTER COLUMN is_closed DROP DEFAULT;
+
+ALTER TABLE futures_klines
+    SET (
+    timescaledb.compress,
+    timescaledb.compress_segmentby = 'exchange, market, symbol',
+    timescaledb.compress_orderby = 'time DESC'
+    );
+
+SELECT add_compression_policy('futures_klines', INTERVAL '30 days');
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- 0007_create_backfill_jobs.up.sql
+-- Persists historical backfills so they survive restarts. 'cursor' is the checkpoint: the open
+-- time of the next kline to fetch. 'pair' is the pair as configured for the exchange.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS backfill_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    exchange TEXT NOT NULL,
+    pair TEXT NOT NULL,
+    interval TEXT NOT NULL,
+    range_start TIMESTAMPTZ NOT NULL,
+    range_end TIMESTAMPTZ NOT NULL,
+    cursor TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    fetched BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_backfill_jobs_status ON backfill_jobs(status);
+
+COMMIT;
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"infosir/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrJobNotFound is returned when no backfill job has the requested id.
+var ErrJobNotFound = errors.New("backfill job not found")
+
+// backfillColumns is the column list read by every backfill query, in scanBackfillJob order.
+const backfillColumns = `id, exchange, pair, interval, range_start, range_end, cursor, status, error, fetched,
+		       created_at, updated_at`
+
+// BackfillRepository manages the "backfill_jobs" table.
+type BackfillRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewBackfillRepository constructs a repository with the given pgx pool.
+func NewBackfillRepository(db *pgxpool.Pool) *BackfillRepository {
+	return &BackfillRepository{db: db}
+}
+
+// Create inserts a new job and returns it with its id and timestamps filled in.
+func (r *BackfillRepository) Create(ctx context.Context, job models.BackfillJob) (models.BackfillJob, error) {
+	query := `
+		INSERT INTO backfill_jobs (exchange, pair, interval, range_start, range_end, cursor, status, error, fetched)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + backfillColumns
+
+	created, err := scanBackfillJob(r.db.QueryRow(ctx, query,
+		job.Exchange, job.Pair, job.Interval, job.Start, job.End, job.Cursor, job.Status, job.Error, job.Fetched))
+	if err != nil {
+		return models.BackfillJob{}, fmt.Errorf("Create backfill job error: %w", err)
+	}
+	return created, nil
+}
+
+// Get retrieves a job by id, or ErrJobNotFound.
+func (r *BackfillRepository) Get(ctx context.Context, id int64) (models.BackfillJob, error) {
+	query := `SELECT ` + backfillColumns + ` FROM backfill_jobs WHERE id = $1`
+
+	job, err := scanBackfillJob(r.db.QueryRow(ctx, query, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.BackfillJob{}, ErrJobNotFound
+	}
+	if err != nil {
+		return models.BackfillJob{}, fmt.Errorf("Get backfill job error: %w", err)
+	}
+	return job, nil
+}
+
+// List retrieves all jobs, newest first. If statuses are given, only jobs in one of them are returned.
+func (r *BackfillRepository) List(ctx context.Context, statuses ...models.BackfillStatus) ([]models.BackfillJob, error) {
+	query := `SELECT ` + backfillColumns + ` FROM backfill_jobs
+		WHERE cardinality($1::text[]) = 0 OR status = ANY($1::text[])
+		ORDER BY id DESC`
+
+	filter := make([]string, 0, len(statuses))
+	for _, s := range statuses {
+		filter = append(filter, string(s))
+	}
+
+	rows, err := r.db.Query(ctx, query, filter)
+	if err != nil {
+		return nil, fmt.Errorf("List backfill jobs query error: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.BackfillJob
+	for rows.Next() {
+		job, err := scanBackfillJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("List backfill jobs scan error: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("List backfill jobs rows error: %w", err)
+	}
+	return jobs, nil
+}
+
+// SaveCheckpoint records the progress of a job: the next open time to fetch and the klines fetched so far.
+func (r *BackfillRepository) SaveCheckpoint(ctx context.Context, id int64, cursor time.Time, fetched int64) error {
+	query := `UPDATE backfill_jobs SET cursor = $2, fetched = $3, updated_at = now() WHERE id = $1`
+
+	if _, err := r.db.Exec(ctx, query, id, cursor, fetched); err != nil {
+		return fmt.Errorf("SaveCheckpoint error: %w", err)
+	}
+	return nil
+}
+
+// SetStatus changes the status of a job and records errMsg (empty clears the previous error).
+func (r *BackfillRepository) SetStatus(ctx context.Context, id int64, status models.BackfillStatus, errMsg string) error {
+	query := `UPDATE backfill_jobs SET status = $2, error = $3, updated_at = now() WHERE id = $1`
+
+	tag, err := r.db.Exec(ctx, query, id, status, errMsg)
+	if err != nil {
+		return fmt.Errorf("SetStatus error: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// scanBackfillJob scans one row selected with backfillColumns.
+func scanBackfillJob(row pgx.Row) (models.BackfillJob, error) {
+	var job models.BackfillJob
+	err := row.Scan(
+		&job.ID,
+		&job.Exchange,
+		&job.Pair,
+		&job.Interval,
+		&job.Start,
+		&job.End,
+		&job.Cursor,
+		&job.Status,
+		&job.Error,
+		&job.Fetched,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	return job, err
+}
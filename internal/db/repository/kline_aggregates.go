@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"infosir/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BaseInterval is the interval of the candles stored in futures_klines. The continuous
+// aggregates and every on-the-fly aggregation are built on top of it, which is why the
+// configuration only accepts it as KLINE_INTERVAL.
+const BaseInterval = models.Interval1m
+
+// aggregateViews maps intervals to the continuous aggregates created by the migrations.
+var aggregateViews = map[models.Interval]string{
+	models.Interval15m: "klines_15m",
+	models.Interval30m: "klines_30m",
+	models.Interval1h:  "klines_1h",
+	models.Interval4h:  "klines_4h",
+	models.Interval1d:  "klines_1d",
+}
+
+// aggregateColumns is the column list selected from continuous aggregates and from the
+// on-the-fly time_bucket query, in scanAggregate order.
+const aggregateColumns = `bucket, exchange, market, symbol, open, high, low, close,
+		       volume, quote_volume, trades, taker_buy_base_volume, taker_buy_quote_volume`
+
+// FindAggregated returns klines of the given interval for the instrument with open (bucket) time
+// within [from, to], in ascending order. A limit <= 0 returns all of them.
+//
+// The BaseInterval is read directly from futures_klines. Intervals with a continuous aggregate
+// (15m, 30m, 1h, 4h, 1d) are read from the materialized view, and the not-yet-materialized tail
+// (starting with the view's last, possibly incomplete bucket) is computed with time_bucket over
+// futures_klines. All other intervals are computed entirely on the fly.
+func (r *KlineRepository) FindAggregated(
+	ctx context.Context,
+	inst models.Instrument,
+	interval models.Interval,
+	from, to time.Time,
+	limit int,
+) ([]models.Kline, error) {
+	if interval == BaseInterval {
+		return r.FindRange(ctx, inst, from, to, limit)
+	}
+
+	step := interval.Duration()
+	if step == 0 {
+		return nil, fmt.Errorf("unsupported interval %q", interval)
+	}
+	if step < BaseInterval.Duration() {
+		return nil, fmt.Errorf("interval %q is finer than the stored interval %q", interval, BaseInterval)
+	}
+
+	var klines []models.Kline
+	tailStart := from
+
+	if view, ok := aggregateViews[interval]; ok {
+		materialized, err := r.findInView(ctx, view, inst, step, from, to, limit)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(materialized); n > 0 {
+			// The last materialized bucket may have been refreshed while still incomplete,
+			// so it is recomputed together with the tail.
+			tailStart = materialized[n-1].Time
+			klines = materialized[:n-1]
+		}
+	}
+
+	remaining := 0
+	if limit > 0 {
+		remaining = limit - len(klines)
+	}
+	tail, err := r.findBucketed(ctx, inst, step, tailStart, to, remaining)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(klines, tail...), nil
+}
+
+// findInView reads buckets within [from, to] from a continuous aggregate.
+func (r *KlineRepository) findInView(
+	ctx context.Context,
+	view string,
+	inst models.Instrument,
+	step time.Duration,
+	from, to time.Time,
+	limit int,
+) ([]models.Kline, error) {
+	// The view name comes from aggregateViews, never from user input.
+	query := `
+		SELECT ` + aggregateColumns + `
+		FROM ` + view + `
+		WHERE exchange = $1 AND market = $2 AND symbol = $3
+		  AND bucket >= $4 AND bucket <= $5
+		ORDER BY bucket ASC
+		LIMIT $6;
+	`
+
+	rows, err := r.db.Query(ctx, query, inst.Exchange, inst.Market, inst.Symbol, from, to, limitArg(limit))
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", view, err)
+	}
+	return collectAggregates(rows, step)
+}
+
+// findBucketed aggregates raw klines into buckets of 'step' with time_bucket. Only buckets
+// starting within [from, to] are returned.
+func (r *KlineRepository) findBucketed(
+	ctx context.Context,
+	inst models.Instrument,
+	step time.Duration,
+	from, to time.Time,
+	limit int,
+) ([]models.Kline, error) {
+	query := `
+		SELECT ` + aggregateColumns + `
+		FROM (
+			SELECT
+				time_bucket($6, time) AS bucket,
+				exchange,
+				market,
+				symbol,
+				first(open_price, time) AS open,
+				max(high_price) AS high,
+				min(low_price) AS low,
+				last(close_price, time) AS close,
+				sum(volume) AS volume,
+				sum(quote_volume) AS quote_volume,
+				sum(trades) AS trades,
+				sum(taker_buy_base_volume) AS taker_buy_base_volume,
+				sum(taker_buy_quote_volume) AS taker_buy_quote_volume
+			FROM futures_klines
+			WHERE exchange = $1 AND market = $2 AND symbol = $3
+			  AND time >= $4 AND time < $5::timestamptz + $6::interval
+			GROUP BY bucket, exchange, market, symbol
+		) b
+		WHERE bucket >= $4 AND bucket <= $5
+		ORDER BY bucket ASC
+		LIMIT $7;
+	`
+
+	rows, err := r.db.Query(ctx, query, inst.Exchange, inst.Market, inst.Symbol, from, to, step, limitArg(limit))
+	if err != nil {
+		return nil, fmt.Errorf("query time_bucket aggregate: %w", err)
+	}
+	return collectAggregates(rows, step)
+}
+
+// collectAggregates scans aggregated rows into klines of the given bucket length. A bucket is
+// reported as closed once its close time has passed.
+func collectAggregates(rows pgx.Rows, step time.Duration) ([]models.Kline, error) {
+	now := time.Now()
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Kline, error) {
+		var k models.Kline
+		err := row.Scan(
+			&k.Time, &k.Exchange, &k.Market, &k.Symbol, &k.OpenPrice, &k.HighPrice, &k.LowPrice,
+			&k.ClosePrice, &k.Volume, &k.QuoteVolume, &k.Trades,
+			&k.TakerBuyBaseVolume, &k.TakerBuyQuoteVolume,
+		)
+		k.CloseTime = models.CloseTimeFor(k.Time, step)
+		k.IsClosed = k.CloseTime.Before(now)
+		return k, err
+	})
+}
+
+// limitArg converts a limit into a query argument; LIMIT NULL is LIMIT ALL in PostgreSQL.
+func limitArg(limit int) *int {
+	if limit <= 0 {
+		return nil
+	}
+	return &limit
+}
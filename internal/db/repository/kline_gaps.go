@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"infosir/internal/models"
+)
+
+// findGapsQuery lists every hole in the open-time sequence of an instrument within [$4, $5].
+// Two sentinel rows one step outside the range make leading and trailing gaps show up the same
+// way as interior ones; LAG pairs every candle with its predecessor and any distance larger than
+// one step is a gap.
+const findGapsQuery = `
+	WITH series AS (
+		SELECT time
+		FROM futures_klines
+		WHERE exchange = $1 AND market = $2 AND symbol = $3 AND time >= $4 AND time <= $5
+		UNION ALL SELECT $4::timestamptz - $6::interval
+		UNION ALL SELECT $5::timestamptz + $6::interval
+	)
+	SELECT prev_time + $6::interval, time - $6::interval
+	FROM (
+		SELECT time, LAG(time) OVER (ORDER BY time) AS prev_time
+		FROM series
+	) s
+	WHERE time - prev_time > $6::interval
+	ORDER BY time;
+`
+
+// FindGaps returns the missing candle ranges of the instrument within [from, to], assuming one
+// candle every 'step'. 'from' and 'to' are truncated to the step, so both bounds are candle open times.
+func (r *KlineRepository) FindGaps(
+	ctx context.Context,
+	inst models.Instrument,
+	from, to time.Time,
+	step time.Duration,
+) ([]models.Gap, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid gap step %s", step)
+	}
+	from, to = from.Truncate(step), to.Truncate(step)
+	if to.Before(from) {
+		return nil, nil
+	}
+
+	rows, err := r.db.Query(ctx, findGapsQuery, inst.Exchange, inst.Market, inst.Symbol, from, to, step)
+	if err != nil {
+		return nil, fmt.Errorf("FindGaps query error: %w", err)
+	}
+	defer rows.Close()
+
+	var gaps []models.Gap
+	for rows.Next() {
+		gap := models.Gap{Instrument: inst}
+		if err := rows.Scan(&gap.From, &gap.To); err != nil {
+			return nil, fmt.Errorf("FindGaps scan error: %w", err)
+		}
+		gap.Missing = int64(gap.To.Sub(gap.From)/step) + 1
+		gaps = append(gaps, gap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("FindGaps rows error: %w", err)
+	}
+
+	return gaps, nil
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"infosir/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// findInstrumentsQuery lists the distinct instruments with stored klines, optionally of one
+// exchange (an empty $1 for all). DISTINCT ON over the leading primary key columns lets TimescaleDB
+// skip-scan the index instead of reading every row.
+const findInstrumentsQuery = `
+	SELECT DISTINCT ON (exchange, market, symbol) exchange, market, symbol
+	FROM futures_klines
+	WHERE $1 = '' OR exchange = $1
+	ORDER BY exchange, market, symbol;
+`
+
+// FindInstruments returns every instrument that has stored klines, ordered by exchange, market
+// and symbol. An empty exchange returns the instruments of all exchanges.
+func (r *KlineRepository) FindInstruments(ctx context.Context, exchange string) ([]models.Instrument, error) {
+	rows, err := r.db.Query(ctx, findInstrumentsQuery, exchange)
+	if err != nil {
+		return nil, fmt.Errorf("find instruments: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Instrument, error) {
+		var inst models.Instrument
+		err := row.Scan(&inst.Exchange, &inst.Market, &inst.Symbol)
+		return inst, err
+	})
+}
@@ -2,6 +2,9 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"infosir/internal/models"
 
@@ -9,7 +12,15 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrNotFound is returned by single-row lookups when no kline matches.
+var ErrNotFound = errors.New("kline not found")
+
+// klineColumns is the standard column list read by every kline query, in scanKline order.
+const klineColumns = `time, close_time, is_closed, exchange, market, symbol, open_price, high_price, low_price, close_price,
+		       volume, quote_volume, trades, taker_buy_base_volume, taker_buy_quote_volume`
+
 // KlineRepository manages read/write operations for the "futures_klines" hypertable.
+// Rows are keyed by (exchange, market, symbol, time).
 type KlineRepository struct {
 	db *pgxpool.Pool
 }
@@ -19,74 +30,204 @@ func NewKlineRepository(db *pgxpool.Pool) *KlineRepository {
 	return &KlineRepository{db: db}
 }
 
-// InsertKline inserts a single Kline into the hypertable.
-// If the (symbol, time) key already exists, it is skipped.
+// insertKlineQuery upserts a single kline. A stored candle that is still open is overwritten
+// with the newer values until a closed version of it arrives; closed candles are final and
+// never touched again.
+const insertKlineQuery = `
+	INSERT INTO futures_klines (
+		time, close_time, is_closed, exchange, market, symbol, open_price, high_price, low_price, close_price,
+		volume, quote_volume, trades, taker_buy_base_volume, taker_buy_quote_volume
+	) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+	ON CONFLICT (exchange, market, symbol, time) DO UPDATE SET
+		close_time = EXCLUDED.close_time,
+		is_closed = EXCLUDED.is_closed,
+		open_price = EXCLUDED.open_price,
+		high_price = EXCLUDED.high_price,
+		low_price = EXCLUDED.low_price,
+		close_price = EXCLUDED.close_price,
+		volume = EXCLUDED.volume,
+		quote_volume = EXCLUDED.quote_volume,
+		trades = EXCLUDED.trades,
+		taker_buy_base_volume = EXCLUDED.taker_buy_base_volume,
+		taker_buy_quote_volume = EXCLUDED.taker_buy_quote_volume
+	WHERE NOT futures_klines.is_closed;
+`
+
+// InsertKline upserts a single Kline into the hypertable.
+// If the (exchange, market, symbol, time) key already exists, the row is only updated while
+// the stored candle is still open.
 func (r *KlineRepository) InsertKline(ctx context.Context, k models.Kline) error {
-	query := `
-		INSERT INTO futures_klines (
-			time, symbol, open_price, high_price, low_price, close_price,
-			volume, quote_volume, trades, taker_buy_base_volume, taker_buy_quote_volume
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
-		ON CONFLICT (symbol, time) DO NOTHING;
-	`
-
-	_, err := r.db.Exec(ctx, query,
-		k.Time, k.Symbol, k.OpenPrice, k.HighPrice, k.LowPrice,
-		k.ClosePrice, k.Volume, k.QuoteVolume, k.Trades,
-		k.TakerBuyBaseVolume, k.TakerBuyQuoteVolume,
-	)
-
+	_, err := r.db.Exec(ctx, insertKlineQuery, klineArgs(k)...)
 	return err
 }
 
-// BatchInsertKlines performs a bulk insert of many klines in a single batch.
-// Duplicate entries are ignored via ON CONFLICT DO NOTHING.
+// BatchInsertKlines performs a bulk upsert of many klines in a single batch.
+// Existing closed candles are left untouched, open ones are updated (see InsertKline).
 func (r *KlineRepository) BatchInsertKlines(ctx context.Context, klines []models.Kline) error {
 	if len(klines) == 0 {
 		return nil
 	}
 
+	// Close reads the results of all queued statements and returns the first error.
+	return r.db.SendBatch(ctx, upsertBatch(klines)).Close()
+}
+
+// StoreKlinesTx upserts klines in a single explicit transaction: either all of them are
+// stored or, on any error, none.
+func (r *KlineRepository) StoreKlinesTx(ctx context.Context, klines []models.Kline) error {
+	if len(klines) == 0 {
+		return nil
+	}
+
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return tx.SendBatch(ctx, upsertBatch(klines)).Close()
+	})
+}
+
+// upsertBatch queues insertKlineQuery for every kline.
+func upsertBatch(klines []models.Kline) *pgx.Batch {
 	batch := &pgx.Batch{}
+	for _, k := range klines {
+		batch.Queue(insertKlineQuery, klineArgs(k)...)
+	}
+	return batch
+}
+
+// FindLast retrieves the most recent Kline for the given instrument.
+// It returns ErrNotFound if the instrument has no stored klines.
+func (r *KlineRepository) FindLast(ctx context.Context, inst models.Instrument) (models.Kline, error) {
 	query := `
-		INSERT INTO futures_klines (
-			time, symbol, open_price, high_price, low_price, close_price,
-			volume, quote_volume, trades, taker_buy_base_volume, taker_buy_quote_volume
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
-		ON CONFLICT (symbol, time) DO NOTHING;
+		SELECT ` + klineColumns + `
+		FROM futures_klines
+		WHERE exchange = $1 AND market = $2 AND symbol = $3
+		ORDER BY time DESC
+		LIMIT 1;
 	`
 
-	for _, k := range klines {
-		batch.Queue(query,
-			k.Time, k.Symbol, k.OpenPrice, k.HighPrice, k.LowPrice,
-			k.ClosePrice, k.Volume, k.QuoteVolume, k.Trades,
-			k.TakerBuyBaseVolume, k.TakerBuyQuoteVolume,
-		)
+	return findOne(scanKline(r.db.QueryRow(ctx, query, inst.Exchange, inst.Market, inst.Symbol)))
+}
+
+// FindFirst retrieves the oldest Kline for the given instrument.
+// It returns ErrNotFound if the instrument has no stored klines.
+func (r *KlineRepository) FindFirst(ctx context.Context, inst models.Instrument) (models.Kline, error) {
+	query := `
+		SELECT ` + klineColumns + `
+		FROM futures_klines
+		WHERE exchange = $1 AND market = $2 AND symbol = $3
+		ORDER BY time ASC
+		LIMIT 1;
+	`
+
+	return findOne(scanKline(r.db.QueryRow(ctx, query, inst.Exchange, inst.Market, inst.Symbol)))
+}
+
+// FindRange retrieves the klines of the instrument with open time within [from, to], in
+// ascending time order. A limit <= 0 returns all of them; for large ranges prefer StreamRange.
+func (r *KlineRepository) FindRange(
+	ctx context.Context,
+	inst models.Instrument,
+	from, to time.Time,
+	limit int,
+) ([]models.Kline, error) {
+	rows, err := r.queryRange(ctx, inst, from, to, limit)
+	if err != nil {
+		return nil, err
 	}
 
-	br := r.db.SendBatch(ctx, batch)
-	defer br.Close()
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Kline, error) {
+		return scanKline(row)
+	})
+}
 
-	_, err := br.Exec()
-	return err
+// StreamRange calls fn for every kline of the instrument with open time within [from, to],
+// in ascending time order. Rows are read from the connection as they arrive, so arbitrarily
+// large ranges never have to fit into memory. Returning an error from fn stops the stream and
+// is returned as is.
+func (r *KlineRepository) StreamRange(
+	ctx context.Context,
+	inst models.Instrument,
+	from, to time.Time,
+	fn func(models.Kline) error,
+) error {
+	rows, err := r.queryRange(ctx, inst, from, to, 0)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		k, err := scanKline(rows)
+		if err != nil {
+			return fmt.Errorf("scan kline: %w", err)
+		}
+		if err := fn(k); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
-// FindLast retrieves the most recent Kline for the given symbol.
-func (r *KlineRepository) FindLast(ctx context.Context, symbol string) (models.Kline, error) {
+// Count returns the number of klines of the instrument with open time within [from, to].
+func (r *KlineRepository) Count(ctx context.Context, inst models.Instrument, from, to time.Time) (int64, error) {
 	query := `
-		SELECT time, symbol, open_price, high_price, low_price, close_price,
-		       volume, quote_volume, trades, taker_buy_base_volume, taker_buy_quote_volume
+		SELECT count(*)
 		FROM futures_klines
-		WHERE symbol = $1
-		ORDER BY time DESC
-		LIMIT 1;
+		WHERE exchange = $1 AND market = $2 AND symbol = $3
+		  AND time >= $4 AND time <= $5;
 	`
 
+	var n int64
+	err := r.db.QueryRow(ctx, query, inst.Exchange, inst.Market, inst.Symbol, from, to).Scan(&n)
+	return n, err
+}
+
+// queryRange runs the ascending range query shared by FindRange and StreamRange.
+func (r *KlineRepository) queryRange(
+	ctx context.Context,
+	inst models.Instrument,
+	from, to time.Time,
+	limit int,
+) (pgx.Rows, error) {
+	query := `
+		SELECT ` + klineColumns + `
+		FROM futures_klines
+		WHERE exchange = $1 AND market = $2 AND symbol = $3
+		  AND time >= $4 AND time <= $5
+		ORDER BY time ASC
+		LIMIT $6;
+	`
+
+	rows, err := r.db.Query(ctx, query, inst.Exchange, inst.Market, inst.Symbol, from, to, limitArg(limit))
+	if err != nil {
+		return nil, fmt.Errorf("query klines range: %w", err)
+	}
+	return rows, nil
+}
+
+// findOne maps pgx.ErrNoRows of a single-row lookup to ErrNotFound.
+func findOne(k models.Kline, err error) (models.Kline, error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Kline{}, ErrNotFound
+	}
+	return k, err
+}
+
+// klineArgs returns the query arguments of a kline in insertKlineQuery column order.
+func klineArgs(k models.Kline) []interface{} {
+	return []interface{}{
+		k.Time, k.CloseTime, k.IsClosed, k.Exchange, k.Market, k.Symbol, k.OpenPrice, k.HighPrice, k.LowPrice,
+		k.ClosePrice, k.Volume, k.QuoteVolume, k.Trades,
+		k.TakerBuyBaseVolume, k.TakerBuyQuoteVolume,
+	}
+}
+
+// scanKline scans a row selected with the standard kline column list.
+func scanKline(row pgx.Row) (models.Kline, error) {
 	var k models.Kline
-	err := r.db.QueryRow(ctx, query, symbol).Scan(
-		&k.Time, &k.Symbol, &k.OpenPrice, &k.HighPrice, &k.LowPrice,
+	err := row.Scan(
+		&k.Time, &k.CloseTime, &k.IsClosed, &k.Exchange, &k.Market, &k.Symbol, &k.OpenPrice, &k.HighPrice, &k.LowPrice,
 		&k.ClosePrice, &k.Volume, &k.QuoteVolume, &k.Trades,
 		&k.TakerBuyBaseVolume, &k.TakerBuyQuoteVolume,
 	)
-
 	return k, err
 }
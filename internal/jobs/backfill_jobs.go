@@ -0,0 +1,374 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/srv"
+	"infosir/internal/utils"
+	"infosir/pkg/crypto"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrInvalidBackfill is returned by Submit for requests that can't be run.
+	ErrInvalidBackfill = errors.New("invalid backfill request")
+	// ErrBackfillState is returned when a job can't make the requested transition, e.g. resuming a finished job.
+	ErrBackfillState = errors.New("backfill job is not in a state that allows this")
+)
+
+// BackfillStore persists backfill jobs and their checkpoints.
+type BackfillStore interface {
+	Create(ctx context.Context, job models.BackfillJob) (models.BackfillJob, error)
+	Get(ctx context.Context, id int64) (models.BackfillJob, error)
+	List(ctx context.Context, statuses ...models.BackfillStatus) ([]models.BackfillJob, error)
+	SaveCheckpoint(ctx context.Context, id int64, cursor time.Time, fetched int64) error
+	SetStatus(ctx context.Context, id int64, status models.BackfillStatus, errMsg string) error
+}
+
+// KlineWriter stores fetched klines.
+type KlineWriter interface {
+	BatchInsertKlines(ctx context.Context, klines []models.Kline) error
+}
+
+// BackfillRequest describes a new backfill: the pair as configured for the exchange and the range
+// of open times to fetch. An empty interval means the stored interval (KlineInterval).
+type BackfillRequest struct {
+	Exchange string    `json:"exchange"`
+	Pair     string    `json:"pair"`
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+}
+
+// BackfillManager runs persisted backfill jobs with bounded concurrency across pairs. Every fetched
+// chunk is stored and checkpointed, so a job that is paused, fails, or is interrupted by a restart
+// continues right where it stopped.
+type BackfillManager struct {
+	store     BackfillStore
+	klines    KlineWriter
+	exchanges *srv.ExchangeRegistry
+
+	slots      chan struct{}
+	retryDelay time.Duration
+
+	mu      sync.Mutex
+	ctx     context.Context
+	running map[int64]*runningBackfill
+	wg      sync.WaitGroup
+}
+
+// runningBackfill tracks a scheduled job so that it can be stopped from the API.
+type runningBackfill struct {
+	cancel context.CancelFunc
+	// stopAs is the status the job ends up in when it is stopped on request.
+	stopAs models.BackfillStatus
+}
+
+// backfillChunkSize is how many klines each request of a backfill fetches.
+const backfillChunkSize = 1000
+
+// backfillMaxRetries is how many times a failing chunk is retried before the job fails.
+const backfillMaxRetries = 5
+
+// NewBackfillManager constructs a manager that runs up to BackfillConcurrency jobs at the same time.
+func NewBackfillManager(store BackfillStore, klines KlineWriter, exchanges *srv.ExchangeRegistry) *BackfillManager {
+	return &BackfillManager{
+		store:      store,
+		klines:     klines,
+		exchanges:  exchanges,
+		slots:      make(chan struct{}, utils.GetConfig().BackfillConcurrency),
+		retryDelay: 5 * time.Second,
+		running:    make(map[int64]*runningBackfill),
+	}
+}
+
+// Start resumes every job that was pending or running when the process stopped. Jobs run until
+// ctx is cancelled; interrupted jobs are left pending and resume on the next Start.
+func (m *BackfillManager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	jobs, err := m.store.List(ctx, models.BackfillPending, models.BackfillRunning)
+	if err != nil {
+		return fmt.Errorf("list unfinished backfills: %w", err)
+	}
+
+	// List is newest first; resume the oldest jobs first.
+	for i := len(jobs) - 1; i >= 0; i-- {
+		utils.Logger.Info("Resuming backfill job",
+			zap.Int64("id", jobs[i].ID),
+			zap.String("pair", jobs[i].Pair),
+			zap.Time("cursor", jobs[i].Cursor))
+		m.schedule(jobs[i])
+	}
+	return nil
+}
+
+// Wait blocks until all scheduled jobs have returned.
+func (m *BackfillManager) Wait() {
+	m.wg.Wait()
+}
+
+// Submit validates and persists a new backfill and schedules it.
+func (m *BackfillManager) Submit(ctx context.Context, req BackfillRequest) (models.BackfillJob, error) {
+	if req.Exchange == "" {
+		req.Exchange = models.ExchangeBinance
+	}
+	if req.Interval == "" {
+		req.Interval = utils.GetConfig().Crypto.KlineInterval
+	}
+
+	if _, err := m.exchanges.Get(req.Exchange); err != nil {
+		return models.BackfillJob{}, fmt.Errorf("%w: %v", ErrInvalidBackfill, err)
+	}
+	if req.Pair == "" {
+		return models.BackfillJob{}, fmt.Errorf("%w: pair is required", ErrInvalidBackfill)
+	}
+	// futures_klines holds a single cadence; every coarser interval is aggregated from it.
+	if req.Interval != utils.GetConfig().Crypto.KlineInterval {
+		return models.BackfillJob{}, fmt.Errorf("%w: only the stored interval %s can be backfilled",
+			ErrInvalidBackfill, utils.GetConfig().Crypto.KlineInterval)
+	}
+	if req.From.IsZero() || req.To.IsZero() || req.To.Before(req.From) {
+		return models.BackfillJob{}, fmt.Errorf("%w: from and to are required and from must not be after to", ErrInvalidBackfill)
+	}
+
+	job, err := m.store.Create(ctx, models.BackfillJob{
+		Exchange: req.Exchange,
+		Pair:     req.Pair,
+		Interval: req.Interval,
+		Start:    req.From,
+		End:      req.To,
+		Cursor:   req.From,
+		Status:   models.BackfillPending,
+	})
+	if err != nil {
+		return models.BackfillJob{}, err
+	}
+
+	utils.Logger.Info("Submitted backfill job",
+		zap.Int64("id", job.ID),
+		zap.String("exchange", job.Exchange),
+		zap.String("pair", job.Pair),
+		zap.Time("from", job.Start),
+		zap.Time("to", job.End))
+
+	m.schedule(job)
+	return job, nil
+}
+
+// Get returns the job with the given id.
+func (m *BackfillManager) Get(ctx context.Context, id int64) (models.BackfillJob, error) {
+	return m.store.Get(ctx, id)
+}
+
+// List returns all jobs, optionally filtered by status, newest first.
+func (m *BackfillManager) List(ctx context.Context, statuses ...models.BackfillStatus) ([]models.BackfillJob, error) {
+	return m.store.List(ctx, statuses...)
+}
+
+// Pause stops a pending or running job, keeping its checkpoint.
+func (m *BackfillManager) Pause(ctx context.Context, id int64) (models.BackfillJob, error) {
+	return m.stop(ctx, id, models.BackfillPaused)
+}
+
+// Cancel stops a job for good. Finished jobs can't be cancelled.
+func (m *BackfillManager) Cancel(ctx context.Context, id int64) (models.BackfillJob, error) {
+	return m.stop(ctx, id, models.BackfillCancelled)
+}
+
+// Resume schedules a paused or failed job again from its checkpoint.
+func (m *BackfillManager) Resume(ctx context.Context, id int64) (models.BackfillJob, error) {
+	job, err := m.store.Get(ctx, id)
+	if err != nil {
+		return models.BackfillJob{}, err
+	}
+	if job.Status != models.BackfillPaused && job.Status != models.BackfillFailed {
+		return job, fmt.Errorf("%w: job %d is %s", ErrBackfillState, id, job.Status)
+	}
+
+	if err := m.store.SetStatus(ctx, id, models.BackfillPending, ""); err != nil {
+		return job, err
+	}
+	job.Status, job.Error = models.BackfillPending, ""
+
+	m.schedule(job)
+	return job, nil
+}
+
+// stop moves a pending, running or (for cancel) paused job into the given status.
+func (m *BackfillManager) stop(ctx context.Context, id int64, status models.BackfillStatus) (models.BackfillJob, error) {
+	job, err := m.store.Get(ctx, id)
+	if err != nil {
+		return models.BackfillJob{}, err
+	}
+	if !job.Active() && !(status == models.BackfillCancelled && job.Status == models.BackfillPaused) {
+		return job, fmt.Errorf("%w: job %d is %s", ErrBackfillState, id, job.Status)
+	}
+
+	m.mu.Lock()
+	if run, ok := m.running[id]; ok {
+		run.stopAs = status
+		run.cancel()
+	}
+	m.mu.Unlock()
+
+	// A job waiting for a slot never runs; a running one also records stopAs when it returns.
+	if err := m.store.SetStatus(ctx, id, status, ""); err != nil {
+		return job, err
+	}
+	job.Status = status
+	return job, nil
+}
+
+// schedule starts a goroutine that waits for a free slot and runs the job.
+func (m *BackfillManager) schedule(job models.BackfillJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ctx == nil {
+		// Not started yet; Start picks the job up as pending.
+		return
+	}
+	if _, ok := m.running[job.ID]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	run := &runningBackfill{cancel: cancel}
+	m.running[job.ID] = run
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() {
+			m.mu.Lock()
+			delete(m.running, job.ID)
+			m.mu.Unlock()
+			cancel()
+		}()
+
+		select {
+		case m.slots <- struct{}{}:
+			defer func() { <-m.slots }()
+		case <-ctx.Done():
+			return
+		}
+
+		m.run(ctx, run, job)
+	}()
+}
+
+// run fetches the job's range from its checkpoint, storing and checkpointing every chunk.
+func (m *BackfillManager) run(ctx context.Context, run *runningBackfill, job models.BackfillJob) {
+	// A background context so that the final status is written even if ctx was cancelled.
+	store := context.Background()
+
+	client, err := m.exchanges.Get(job.Exchange)
+	if err != nil {
+		m.finish(store, job, models.BackfillFailed, err)
+		return
+	}
+	if err := m.store.SetStatus(ctx, job.ID, models.BackfillRunning, ""); err != nil {
+		utils.Logger.Error("Failed to mark backfill job running", zap.Int64("id", job.ID), zap.Error(err))
+		return
+	}
+
+	utils.Logger.Info("Backfill job started",
+		zap.Int64("id", job.ID),
+		zap.String("exchange", job.Exchange),
+		zap.String("pair", job.Pair),
+		zap.Time("cursor", job.Cursor),
+		zap.Time("end", job.End))
+
+	for attempt := 0; ; attempt++ {
+		var pager *crypto.KlinePaginator
+		pager, err = crypto.NewKlinePaginator(client, job.Exchange, job.Pair, job.Interval, job.Cursor, job.End, backfillChunkSize)
+		if err != nil {
+			break
+		}
+
+		for pager.Next(ctx) {
+			klines := pager.Klines()
+			if err = m.klines.BatchInsertKlines(ctx, klines); err != nil {
+				break
+			}
+			job.Cursor = pager.Cursor()
+			job.Fetched += int64(len(klines))
+			if err = m.store.SaveCheckpoint(ctx, job.ID, job.Cursor, job.Fetched); err != nil {
+				break
+			}
+			attempt = 0
+		}
+		if err == nil {
+			err = pager.Err()
+		}
+		if err == nil || ctx.Err() != nil || attempt >= backfillMaxRetries {
+			break
+		}
+
+		utils.Logger.Warn("Backfill chunk failed; will retry",
+			zap.Int64("id", job.ID),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", m.retryDelay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(m.retryDelay):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		m.mu.Lock()
+		stopAs := run.stopAs
+		m.mu.Unlock()
+
+		if stopAs != "" {
+			// Pause/Cancel already wrote the status; write it again in case our "running" landed after it.
+			m.finish(store, job, stopAs, nil)
+			return
+		}
+		// Shutdown: leave the job pending so that it resumes on the next start.
+		m.finish(store, job, models.BackfillPending, nil)
+		return
+	}
+	if err != nil {
+		m.finish(store, job, models.BackfillFailed, err)
+		return
+	}
+	m.finish(store, job, models.BackfillDone, nil)
+}
+
+// finish records the final status of a run.
+func (m *BackfillManager) finish(ctx context.Context, job models.BackfillJob, status models.BackfillStatus, cause error) {
+	var errMsg string
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+	if err := m.store.SetStatus(ctx, job.ID, status, errMsg); err != nil {
+		utils.Logger.Error("Failed to record backfill job status", zap.Int64("id", job.ID), zap.Error(err))
+	}
+
+	logFn := utils.Logger.Info
+	if status == models.BackfillFailed {
+		logFn = utils.Logger.Error
+	}
+	logFn("Backfill job finished",
+		zap.Int64("id", job.ID),
+		zap.String("pair", job.Pair),
+		zap.String("status", string(status)),
+		zap.Int64("fetched", job.Fetched),
+		zap.Time("cursor", job.Cursor),
+		zap.Error(cause))
+}
@@ -0,0 +1,322 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"infosir/internal/db/repository"
+	"infosir/internal/models"
+	"infosir/internal/srv"
+	"infosir/internal/utils"
+	"infosir/pkg/crypto"
+
+	"go.uber.org/zap"
+)
+
+// GapRepository is the part of the kline repository the gap healer needs.
+type GapRepository interface {
+	FindFirst(ctx context.Context, inst models.Instrument) (models.Kline, error)
+	FindGaps(ctx context.Context, inst models.Instrument, from, to time.Time, step time.Duration) ([]models.Gap, error)
+	BatchInsertKlines(ctx context.Context, klines []models.Kline) error
+}
+
+// BackfillLister lists backfill jobs, so that the gap healer can leave alone the instruments a
+// backfill is still filling.
+type BackfillLister interface {
+	List(ctx context.Context, statuses ...models.BackfillStatus) ([]models.BackfillJob, error)
+}
+
+// GapStatus reports the outcome of the latest gap scan and the progress of healing it.
+type GapStatus struct {
+	// Running is set while a scan/heal cycle is in progress.
+	Running bool `json:"running"`
+	// LastScan is when the latest cycle started.
+	LastScan time.Time `json:"last_scan"`
+	// Gaps are the gaps found by the latest scan that are not healed (yet).
+	Gaps []models.Gap `json:"gaps"`
+	// Unhealable are the gaps found by the latest scan for which the exchange has no candles, e.g.
+	// a trading halt. They are not re-fetched again while the process runs.
+	Unhealable []models.Gap `json:"unhealable"`
+	// Healing is the gap currently being re-fetched, if any.
+	Healing *models.Gap `json:"healing,omitempty"`
+	// HealedGaps, UnhealableGaps and FailedGaps count the gaps of the latest cycle.
+	HealedGaps     int `json:"healed_gaps"`
+	UnhealableGaps int `json:"unhealable_gaps"`
+	FailedGaps     int `json:"failed_gaps"`
+	// HealedKlines counts the klines inserted since startup.
+	HealedKlines int64 `json:"healed_klines"`
+}
+
+// GapHealer periodically scans the stored klines of every configured pair for holes and
+// re-fetches exactly the missing ranges from the exchange.
+type GapHealer struct {
+	repo      GapRepository
+	backfills BackfillLister
+	exchanges *srv.ExchangeRegistry
+	window    time.Duration
+
+	mu         sync.RWMutex
+	status     GapStatus
+	unhealable map[gapKey]bool
+}
+
+// gapKey identifies a gap across scans.
+type gapKey struct {
+	inst     models.Instrument
+	from, to int64
+}
+
+// keyOf returns the key of a gap.
+func keyOf(gap models.Gap) gapKey {
+	return gapKey{inst: gap.Instrument, from: gap.From.UnixMilli(), to: gap.To.UnixMilli()}
+}
+
+// NewGapHealer constructs a GapHealer that scans the last GapScanWindow of history.
+func NewGapHealer(repo GapRepository, backfills BackfillLister, exchanges *srv.ExchangeRegistry) *GapHealer {
+	return &GapHealer{
+		repo:       repo,
+		backfills:  backfills,
+		exchanges:  exchanges,
+		window:     utils.GetConfig().GapScanWindow,
+		unhealable: make(map[gapKey]bool),
+	}
+}
+
+// Status returns a snapshot of the current gap status.
+func (h *GapHealer) Status() GapStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	status := h.status
+	status.Gaps = append([]models.Gap(nil), h.status.Gaps...)
+	status.Unhealable = append([]models.Gap(nil), h.status.Unhealable...)
+	return status
+}
+
+// Run scans and heals every 'every' until ctx is cancelled.
+func (h *GapHealer) Run(ctx context.Context, every time.Duration) {
+	utils.Logger.Info("Gap healer started", zap.Duration("every", every), zap.Duration("window", h.window))
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		h.ScanAndHeal(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			utils.Logger.Info("Gap healer context done; stopping.")
+			return
+		}
+	}
+}
+
+// ScanAndHeal runs one cycle: it lists the gaps of every configured pair between its first stored
+// candle (or the start of the scan window, whichever is later) and the last closed candle, then
+// re-fetches each gap. Storage before the first stored candle is the backfill's business, not a gap,
+// and so are instruments with a pending, running or paused backfill: its unfilled tail isn't a gap.
+func (h *GapHealer) ScanAndHeal(ctx context.Context) {
+	interval, err := models.ParseInterval(utils.GetConfig().Crypto.KlineInterval)
+	if err != nil {
+		utils.Logger.Error("Cannot scan for gaps", zap.Error(err))
+		return
+	}
+	backfilling, err := h.backfilling(ctx)
+	if err != nil {
+		utils.Logger.Error("Cannot scan for gaps: failed to list backfills", zap.Error(err))
+		return
+	}
+	step := interval.Duration()
+
+	now := time.Now()
+	h.mu.Lock()
+	h.status.Running = true
+	h.status.LastScan = now
+	h.status.HealedGaps, h.status.UnhealableGaps, h.status.FailedGaps = 0, 0, 0
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.status.Running = false
+		h.status.Healing = nil
+		h.mu.Unlock()
+	}()
+
+	// The candle that is still forming is not a gap.
+	to := now.Truncate(step).Add(-step)
+	windowStart := now.Add(-h.window)
+
+	type target struct {
+		client srv.ExchangeClient
+		pair   string
+		gap    models.Gap
+	}
+	var targets []target
+	var gaps, unhealable []models.Gap
+
+	pairsByExchange := utils.GetConfig().Crypto.PairsByExchange()
+	for _, exchange := range sortedKeys(pairsByExchange) {
+		client, err := h.exchanges.Get(exchange)
+		if err != nil {
+			utils.Logger.Error("No client for configured exchange", zap.String("exchange", exchange), zap.Error(err))
+			continue
+		}
+
+		for _, pair := range pairsByExchange[exchange] {
+			inst := crypto.InstrumentFor(exchange, pair)
+			if backfilling[inst] {
+				utils.Logger.Debug("Skipping gap scan while backfilling", zap.Stringer("instrument", inst))
+				continue
+			}
+
+			first, err := h.repo.FindFirst(ctx, inst)
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				utils.Logger.Error("Failed to find first stored kline", zap.Stringer("instrument", inst), zap.Error(err))
+				continue
+			}
+
+			from := first.Time
+			if from.Before(windowStart) {
+				from = windowStart
+			}
+
+			found, err := h.repo.FindGaps(ctx, inst, from, to, step)
+			if err != nil {
+				utils.Logger.Error("Failed to find gaps", zap.Stringer("instrument", inst), zap.Error(err))
+				continue
+			}
+			for _, gap := range found {
+				if h.isUnhealable(gap) {
+					unhealable = append(unhealable, gap)
+					continue
+				}
+				targets = append(targets, target{client: client, pair: pair, gap: gap})
+				gaps = append(gaps, gap)
+			}
+		}
+	}
+
+	h.mu.Lock()
+	h.status.Gaps = gaps
+	h.status.Unhealable = unhealable
+	h.status.UnhealableGaps = len(unhealable)
+	h.mu.Unlock()
+
+	if len(gaps) > 0 {
+		utils.Logger.Info("Found kline gaps", zap.Int("gaps", len(gaps)), zap.Int("unhealable", len(unhealable)))
+	}
+
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			return
+		}
+
+		gap := t.gap
+		h.mu.Lock()
+		h.status.Healing = &gap
+		h.mu.Unlock()
+
+		inserted, err := h.heal(ctx, t.client, t.pair, interval, gap)
+
+		h.mu.Lock()
+		h.status.HealedKlines += inserted
+		switch {
+		case err != nil:
+			h.status.FailedGaps++
+		case inserted == 0:
+			h.status.UnhealableGaps++
+			h.status.Gaps = removeGap(h.status.Gaps, gap)
+			h.status.Unhealable = append(h.status.Unhealable, gap)
+			h.unhealable[keyOf(gap)] = true
+		default:
+			h.status.HealedGaps++
+			h.status.Gaps = removeGap(h.status.Gaps, gap)
+		}
+		h.mu.Unlock()
+
+		if err != nil {
+			utils.Logger.Error("Failed to heal gap",
+				zap.Stringer("instrument", gap.Instrument),
+				zap.Time("from", gap.From),
+				zap.Time("to", gap.To),
+				zap.Error(err))
+			continue
+		}
+		if inserted == 0 {
+			utils.Logger.Warn("Exchange has no klines for gap; not re-fetching it",
+				zap.Stringer("instrument", gap.Instrument),
+				zap.Time("from", gap.From),
+				zap.Time("to", gap.To))
+			continue
+		}
+		utils.Logger.Info("Healed gap",
+			zap.Stringer("instrument", gap.Instrument),
+			zap.Time("from", gap.From),
+			zap.Time("to", gap.To),
+			zap.Int64("klines", inserted))
+	}
+}
+
+// backfilling returns the instruments of the backfills that haven't finished yet.
+func (h *GapHealer) backfilling(ctx context.Context) (map[models.Instrument]bool, error) {
+	active, err := h.backfills.List(ctx, models.BackfillPending, models.BackfillRunning, models.BackfillPaused)
+	if err != nil {
+		return nil, err
+	}
+
+	insts := make(map[models.Instrument]bool, len(active))
+	for _, job := range active {
+		insts[crypto.InstrumentFor(job.Exchange, job.Pair)] = true
+	}
+	return insts, nil
+}
+
+// heal re-fetches the klines of one gap and stores them. It returns the number of klines inserted,
+// which is zero for a gap the exchange has no data for (e.g. a trading halt).
+func (h *GapHealer) heal(
+	ctx context.Context,
+	client srv.ExchangeClient,
+	pair string,
+	interval models.Interval,
+	gap models.Gap,
+) (int64, error) {
+	const chunkSize = 1000
+
+	pager, err := crypto.NewKlinePaginator(client, gap.Instrument.Exchange, pair, interval.String(), gap.From, gap.To, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var inserted int64
+	for pager.Next(ctx) {
+		klines := pager.Klines()
+		if err := h.repo.BatchInsertKlines(ctx, klines); err != nil {
+			return inserted, err
+		}
+		inserted += int64(len(klines))
+	}
+	return inserted, pager.Err()
+}
+
+// removeGap returns gaps without the given one.
+func removeGap(gaps []models.Gap, gap models.Gap) []models.Gap {
+	kept := gaps[:0]
+	for _, g := range gaps {
+		if g.Instrument != gap.Instrument || !g.From.Equal(gap.From) {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// isUnhealable reports whether an earlier cycle found no exchange data for the gap.
+func (h *GapHealer) isUnhealable(gap models.Gap) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.unhealable[keyOf(gap)]
+}
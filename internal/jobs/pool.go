@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"infosir/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// PairTask is one unit of fetch work: a pair as configured for an exchange.
+type PairTask struct {
+	Exchange string
+	Pair     string
+}
+
+// CycleReport summarises one fan-out over all pairs.
+type CycleReport struct {
+	Name      string        `json:"name"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	// Skipped counts the pairs never started because the cycle was cancelled.
+	Skipped int `json:"skipped"`
+	// AvgLatency and MaxLatency are measured per pair that ran.
+	AvgLatency time.Duration `json:"avg_latency"`
+	MaxLatency time.Duration `json:"max_latency"`
+	// Failures maps "exchange/pair" to the error of every failed pair.
+	Failures map[string]string `json:"failures,omitempty"`
+}
+
+// ConfiguredPairs returns a task for every configured pair of every exchange, in a stable order.
+func ConfiguredPairs() []PairTask {
+	pairsByExchange := utils.GetConfig().Crypto.PairsByExchange()
+
+	var tasks []PairTask
+	for _, exchange := range sortedKeys(pairsByExchange) {
+		for _, pair := range pairsByExchange[exchange] {
+			tasks = append(tasks, PairTask{Exchange: exchange, Pair: pair})
+		}
+	}
+	return tasks
+}
+
+// RunPairs runs fn for every task on at most 'concurrency' workers and reports how the cycle went.
+// Workers share the exchange clients, so their requests are throttled by the shared rate limiters:
+// a worker simply blocks until its exchange has weight left. Tasks not started before ctx is
+// cancelled are counted as skipped and left out of the latencies.
+func RunPairs(
+	ctx context.Context,
+	name string,
+	concurrency int,
+	tasks []PairTask,
+	fn func(ctx context.Context, task PairTask) error,
+) CycleReport {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	report := CycleReport{Name: name, Started: time.Now()}
+	var (
+		mu    sync.Mutex
+		total time.Duration
+		wg    sync.WaitGroup
+	)
+	record := func(task PairTask, latency time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		total += latency
+		if latency > report.MaxLatency {
+			report.MaxLatency = latency
+		}
+		if err != nil {
+			report.Failed++
+			if report.Failures == nil {
+				report.Failures = make(map[string]string)
+			}
+			report.Failures[task.Exchange+"/"+task.Pair] = err.Error()
+			return
+		}
+		report.Succeeded++
+	}
+
+	queue := make(chan PairTask)
+	for i := 0; i < concurrency && i < len(tasks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				started := time.Now()
+				err := fn(ctx, task)
+				record(task, time.Since(started), err)
+			}
+		}()
+	}
+
+	for i, task := range tasks {
+		select {
+		case queue <- task:
+			continue
+		case <-ctx.Done():
+		}
+		mu.Lock()
+		report.Skipped = len(tasks) - i
+		mu.Unlock()
+		break
+	}
+	close(queue)
+	wg.Wait()
+
+	report.Duration = time.Since(report.Started)
+	if n := report.Succeeded + report.Failed; n > 0 {
+		report.AvgLatency = total / time.Duration(n)
+	}
+	return report
+}
+
+// logCycleReport logs a cycle report; failures are logged at warn level, sorted by pair.
+func logCycleReport(report CycleReport) {
+	fields := []zap.Field{
+		zap.String("cycle", report.Name),
+		zap.Duration("duration", report.Duration),
+		zap.Int("succeeded", report.Succeeded),
+		zap.Int("failed", report.Failed),
+		zap.Int("skipped", report.Skipped),
+		zap.Duration("avgLatency", report.AvgLatency),
+		zap.Duration("maxLatency", report.MaxLatency),
+	}
+	if report.Failed == 0 {
+		utils.Logger.Info("Fetch cycle finished", fields...)
+		return
+	}
+
+	failed := make([]string, 0, len(report.Failures))
+	for pair := range report.Failures {
+		failed = append(failed, pair)
+	}
+	sort.Strings(failed)
+	utils.Logger.Warn("Fetch cycle finished with failures", append(fields, zap.Strings("failedPairs", failed))...)
+}
@@ -2,52 +2,157 @@ package jobs
 
 import (
 	"context"
+	"sort"
+	"sync"
 	"time"
 
+	"infosir/internal/models"
 	"infosir/internal/srv"
 	"infosir/internal/utils"
+	"infosir/pkg/crypto"
 
 	"go.uber.org/zap"
 )
 
-// RunScheduledRequests starts a ticker that, on every interval, fetches a small set of
-// new klines from the BinanceClient for each pair, then publishes them to NATS JetStream.
-// This is used to keep data regularly updated in near-real-time.
-func RunScheduledRequests(ctx context.Context, service srv.InfoSirService, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// LatestKlineWriter records the latest ingested candle of every series, e.g. in the Key-Value bucket.
+type LatestKlineWriter interface {
+	PutLatest(ctx context.Context, klines []models.Kline) error
+}
+
+// RunScheduledRequests runs one candle-close aligned schedule per configured interval
+// (ScheduleIntervals). Right after every close (plus ScheduleSettleDelay) it fetches a small set of
+// new klines of that interval from the exchange for each configured pair of every exchange, then
+// publishes them to NATS JetStream and records the newest candles in latest, if not nil. This is used
+// to keep data regularly updated in near-real-time.
+func RunScheduledRequests(ctx context.Context, service srv.InfoSirService, latest LatestKlineWriter) {
+	cfg := utils.GetConfig().Crypto
+
+	var wg sync.WaitGroup
+	for _, raw := range cfg.ScheduleIntervals {
+		interval, err := models.ParseInterval(raw)
+		if err != nil {
+			utils.Logger.Error("Skipping unsupported schedule interval", zap.Error(err))
+			continue
+		}
+
+		schedule := NewAlignedSchedule(interval, cfg.ScheduleSettleDelay, func(ctx context.Context, closed time.Time) {
+			FetchAndPublish(ctx, service, latest, interval, closed)
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			schedule.Run(ctx)
+		}()
+	}
 
 	utils.Logger.Info("Scheduled job started",
-		zap.Duration("interval", interval))
-
-	for {
-		select {
-		case <-ticker.C:
-			for _, pair := range utils.GetConfig().Crypto.Pairs {
-				klines, err := service.GetKlines(ctx, pair, utils.GetConfig().Crypto.KlineInterval,
-					int64(utils.GetConfig().Crypto.KlineLimit))
-				if err != nil {
-					utils.Logger.Error("Failed to get klines from Binance",
-						zap.String("pair", pair),
-						zap.Error(err))
-					continue
-				}
-
-				if err := service.PublishKlinesJS(ctx, klines); err != nil {
-					utils.Logger.Error("Failed to publish klines to NATS",
-						zap.String("pair", pair),
-						zap.Error(err))
-					continue
-				}
-
-				utils.Logger.Debug("Fetched & published klines successfully",
-					zap.String("pair", pair),
-					zap.Int("klinesCount", len(klines)))
+		zap.Strings("intervals", cfg.ScheduleIntervals),
+		zap.Duration("settleDelay", cfg.ScheduleSettleDelay))
+
+	wg.Wait()
+	utils.Logger.Info("Scheduled job context done; stopping.")
+}
+
+// FetchAndPublish fetches the KlineLimit klines of the interval up to and including the candle that
+// just closed (opening at closed) for every configured pair and publishes them, fanning the pairs out
+// over FetchConcurrency workers. The window is bounded at closed, so the closed candle is fetched even
+// with a limit of 1, rather than the one that has just opened.
+func FetchAndPublish(ctx context.Context, service srv.InfoSirService, latest LatestKlineWriter, interval models.Interval, closed time.Time) {
+	limit := int64(utils.GetConfig().Crypto.KlineLimit)
+	start := closed.Add(-time.Duration(limit-1) * interval.Duration())
+
+	report := RunPairs(ctx, "schedule "+interval.String(), utils.GetConfig().Crypto.FetchConcurrency, ConfiguredPairs(),
+		func(ctx context.Context, task PairTask) error {
+			klines, err := service.GetKlinesRange(ctx, task.Exchange, task.Pair, interval.String(), start, closed, limit)
+			if err != nil {
+				utils.Logger.Error("Failed to get klines from exchange",
+					zap.String("exchange", task.Exchange),
+					zap.String("pair", task.Pair),
+					zap.Stringer("interval", interval),
+					zap.Error(err))
+				return err
 			}
 
-		case <-ctx.Done():
-			utils.Logger.Info("Scheduled job context done; stopping.")
+			ack, err := service.PublishKlinesJS(ctx, klines)
+			if err != nil {
+				utils.Logger.Error("Failed to publish klines to NATS",
+					zap.String("exchange", task.Exchange),
+					zap.String("pair", task.Pair),
+					zap.Stringer("interval", interval),
+					zap.Error(err))
+				return err
+			}
+			putLatest(ctx, latest, klines)
+
+			utils.Logger.Debug("Fetched & published klines successfully",
+				zap.String("exchange", task.Exchange),
+				zap.String("pair", task.Pair),
+				zap.Stringer("interval", interval),
+				zap.Time("closedCandle", closed),
+				zap.Int("klinesCount", len(klines)),
+				zap.Int("duplicates", ack.Duplicates))
+			return nil
+		})
+
+	logCycleReport(report)
+	if report.Duration > interval.Duration() {
+		utils.Logger.Warn("Fetch cycle took longer than its interval; consider raising FETCH_CONCURRENCY",
+			zap.Stringer("interval", interval),
+			zap.Duration("duration", report.Duration))
+	}
+}
+
+// sortedKeys returns the keys of a per-exchange map in a stable order.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RunKlineStream consumes live klines from the Binance WebSocket stream and publishes them to
+// NATS JetStream as they arrive. Closed candles are always published; in-progress candles only
+// if StreamPublishOpen is enabled. Every candle, open or closed, is recorded in latest if not nil.
+// It blocks until ctx is cancelled.
+func RunKlineStream(ctx context.Context, service srv.InfoSirService, stream *crypto.BinanceStreamClient, latest LatestKlineWriter) {
+	publishOpen := utils.GetConfig().Crypto.StreamPublishOpen
+
+	utils.Logger.Info("Kline stream job started",
+		zap.Strings("streams", stream.Streams()),
+		zap.Bool("publishOpen", publishOpen))
+
+	err := stream.Run(ctx, func(ctx context.Context, k models.Kline) {
+		putLatest(ctx, latest, []models.Kline{k})
+		if !k.IsClosed && !publishOpen {
 			return
 		}
+
+		if _, err := service.PublishKlinesJS(ctx, []models.Kline{k}); err != nil {
+			utils.Logger.Error("Failed to publish streamed kline to NATS",
+				zap.String("pair", k.Symbol),
+				zap.Error(err))
+			return
+		}
+
+		utils.Logger.Debug("Published streamed kline",
+			zap.String("pair", k.Symbol),
+			zap.Time("time", k.Time),
+			zap.Bool("closed", k.IsClosed))
+	})
+
+	utils.Logger.Info("Kline stream job stopped", zap.Error(err))
+}
+
+// putLatest records klines in latest, if configured. Failures are logged only: the bucket is a
+// convenience view and must not hold up ingestion.
+func putLatest(ctx context.Context, latest LatestKlineWriter, klines []models.Kline) {
+	if latest == nil || len(klines) == 0 {
+		return
+	}
+	if err := latest.PutLatest(ctx, klines); err != nil {
+		utils.Logger.Warn("Failed to update latest klines bucket", zap.Error(err))
 	}
 }
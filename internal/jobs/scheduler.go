@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// NextTick returns the first moment after 'now' at which a candle of the interval has closed and
+// the settle delay has passed, i.e. the next candle boundary plus 'settle'.
+func NextTick(now time.Time, interval models.Interval, settle time.Duration) time.Time {
+	tick := interval.Truncate(now.Add(-settle)).Add(interval.Duration()).Add(settle)
+	if !tick.After(now) {
+		tick = tick.Add(interval.Duration())
+	}
+	return tick
+}
+
+// AlignedSchedule calls a function right after every candle close of an interval (plus a settle
+// delay), instead of at a fixed period from an arbitrary start. If the previous call is still in
+// flight when the next candle closes, that tick is skipped: the next call fetches the latest
+// candles anyway, so the skipped one is coalesced into it.
+type AlignedSchedule struct {
+	interval models.Interval
+	settle   time.Duration
+	fn       func(ctx context.Context, closed time.Time)
+
+	inFlight atomic.Bool
+	skipped  atomic.Int64
+}
+
+// NewAlignedSchedule constructs a schedule calling fn for every closed candle of the interval.
+// fn receives the open time of the candle that just closed.
+func NewAlignedSchedule(
+	interval models.Interval,
+	settle time.Duration,
+	fn func(ctx context.Context, closed time.Time),
+) *AlignedSchedule {
+	return &AlignedSchedule{interval: interval, settle: settle, fn: fn}
+}
+
+// Skipped returns the number of ticks skipped because the previous run was still in flight.
+func (s *AlignedSchedule) Skipped() int64 {
+	return s.skipped.Load()
+}
+
+// Run blocks until ctx is cancelled and waits for the in-flight call, if any, to return.
+func (s *AlignedSchedule) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		tick := NextTick(time.Now(), s.interval, s.settle)
+		timer := time.NewTimer(time.Until(tick))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		closed := s.interval.Truncate(tick.Add(-s.settle)).Add(-s.interval.Duration())
+		if !s.inFlight.CompareAndSwap(false, true) {
+			s.skipped.Add(1)
+			utils.Logger.Warn("Previous scheduled run still in flight; skipping tick",
+				zap.Stringer("interval", s.interval),
+				zap.Time("candle", closed),
+				zap.Int64("skipped", s.skipped.Load()))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.inFlight.Store(false)
+			s.fn(ctx, closed)
+		}()
+	}
+}
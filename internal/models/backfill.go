@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// BackfillStatus is the lifecycle state of a BackfillJob.
+type BackfillStatus string
+
+const (
+	// BackfillPending jobs wait for a free worker.
+	BackfillPending BackfillStatus = "pending"
+	// BackfillRunning jobs are being fetched right now.
+	BackfillRunning BackfillStatus = "running"
+	// BackfillPaused jobs keep their checkpoint until they are resumed.
+	BackfillPaused BackfillStatus = "paused"
+	// BackfillDone jobs reached the end of their range.
+	BackfillDone BackfillStatus = "done"
+	// BackfillFailed jobs gave up after repeated errors; they can be resumed.
+	BackfillFailed BackfillStatus = "failed"
+	// BackfillCancelled jobs are stopped for good.
+	BackfillCancelled BackfillStatus = "cancelled"
+)
+
+// BackfillJob is a persisted request to fetch the history of one pair over [Start, End].
+// Cursor is the checkpoint: the open time of the next kline to fetch.
+type BackfillJob struct {
+	ID        int64          `json:"id"`
+	Exchange  string         `json:"exchange"`
+	Pair      string         `json:"pair"`
+	Interval  string         `json:"interval"`
+	Start     time.Time      `json:"start"`
+	End       time.Time      `json:"end"`
+	Cursor    time.Time      `json:"cursor"`
+	Status    BackfillStatus `json:"status"`
+	Error     string         `json:"error,omitempty"`
+	Fetched   int64          `json:"fetched"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Active reports whether the job still has work scheduled (pending or running).
+func (j BackfillJob) Active() bool {
+	return j.Status == BackfillPending || j.Status == BackfillRunning
+}
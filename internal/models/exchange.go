@@ -0,0 +1,32 @@
+package models
+
+import "fmt"
+
+// Names of the supported exchanges. They are used as keys of the exchange client registry
+// and in the per-exchange pair configuration.
+const (
+	ExchangeBinance = "binance"
+	ExchangeBybit   = "bybit"
+	ExchangeOKX     = "okx"
+)
+
+// Markets distinguish products of the same symbol on one exchange.
+const (
+	// MarketSpot is the spot market.
+	MarketSpot = "spot"
+	// MarketFutures covers perpetual and delivery futures (e.g. Binance USD-M, Bybit linear, OKX swaps).
+	MarketFutures = "futures"
+)
+
+// Instrument identifies a single kline series: a symbol traded on a market of an exchange.
+// It is the key under which klines are stored, i.e. (exchange, market, symbol, time) is unique.
+type Instrument struct {
+	Exchange string `json:"exchange"`
+	Market   string `json:"market"`
+	Symbol   string `json:"symbol"`
+}
+
+// String returns a dotted representation, e.g. "binance.futures.BTCUSDT".
+func (i Instrument) String() string {
+	return fmt.Sprintf("%s.%s.%s", i.Exchange, i.Market, i.Symbol)
+}
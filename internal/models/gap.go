@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Gap is a run of consecutive candles missing from storage. From and To are the open times
+// of the first and the last missing candle, both inclusive.
+type Gap struct {
+	Instrument Instrument `json:"instrument"`
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	// Missing is the number of candles in the gap.
+	Missing int64 `json:"missing"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Interval is a kline timeframe in exchange notation, e.g. "1m", "4h" or "1d".
+type Interval string
+
+// Supported kline intervals. The string values follow Binance notation, which is
+// also used as the canonical notation across the whole application.
+const (
+	Interval1m  Interval = "1m"
+	Interval3m  Interval = "3m"
+	Interval5m  Interval = "5m"
+	Interval15m Interval = "15m"
+	Interval30m Interval = "30m"
+	Interval1h  Interval = "1h"
+	Interval2h  Interval = "2h"
+	Interval4h  Interval = "4h"
+	Interval6h  Interval = "6h"
+	Interval8h  Interval = "8h"
+	Interval12h Interval = "12h"
+	Interval1d  Interval = "1d"
+	Interval3d  Interval = "3d"
+	Interval1w  Interval = "1w"
+)
+
+// intervalDurations maps each supported interval to its fixed duration.
+// Monthly candles ("1M") are intentionally not supported, as they have no fixed length.
+var intervalDurations = map[Interval]time.Duration{
+	Interval1m:  time.Minute,
+	Interval3m:  3 * time.Minute,
+	Interval5m:  5 * time.Minute,
+	Interval15m: 15 * time.Minute,
+	Interval30m: 30 * time.Minute,
+	Interval1h:  time.Hour,
+	Interval2h:  2 * time.Hour,
+	Interval4h:  4 * time.Hour,
+	Interval6h:  6 * time.Hour,
+	Interval8h:  8 * time.Hour,
+	Interval12h: 12 * time.Hour,
+	Interval1d:  24 * time.Hour,
+	Interval3d:  72 * time.Hour,
+	Interval1w:  7 * 24 * time.Hour,
+}
+
+// ParseInterval validates the given string and returns it as an Interval.
+func ParseInterval(s string) (Interval, error) {
+	i := Interval(s)
+	if _, ok := intervalDurations[i]; !ok {
+		return "", fmt.Errorf("unsupported kline interval %q", s)
+	}
+	return i, nil
+}
+
+// Duration returns the fixed length of one candle of this interval,
+// or 0 if the interval is not supported.
+func (i Interval) Duration() time.Duration {
+	return intervalDurations[i]
+}
+
+// Truncate returns the open time of the candle of this interval that contains t. Candles are
+// aligned to the Unix epoch in UTC, except weekly candles, which open on Mondays.
+func (i Interval) Truncate(t time.Time) time.Time {
+	d := i.Duration()
+	if d <= 0 {
+		return t
+	}
+	if i == Interval1w {
+		// time.Time's zero value (January 1, year 1) is a Monday.
+		return t.Truncate(d)
+	}
+	ms := t.UnixMilli()
+	return time.UnixMilli(ms - ms%d.Milliseconds()).In(t.Location())
+}
+
+// String implements fmt.Stringer.
+func (i Interval) String() string {
+	return string(i)
+}
@@ -1,9 +1,11 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/shopspring/decimal"
 )
 
 // Kline represents a single candlestick (OHLCV) data point for a given symbol
@@ -11,26 +13,41 @@ import (
 // another exchange, then stored in TimescaleDB.
 //
 // Fields:
-//   - Time: The timestamp associated with this kline (UTC).
+//   - Time: The open time of this kline (UTC).
+//   - CloseTime: The close time of this kline, i.e. the last millisecond it covers.
+//   - IsClosed: Whether the candle is final; an open candle is still forming and may change.
+//   - Exchange: The exchange the kline comes from, e.g. "binance".
+//   - Market: The market on that exchange, e.g. "futures" or "spot".
 //   - Symbol: The trading pair, e.g. "BTCUSDT".
+//   - Interval: The candle interval, e.g. "1m". It travels with the kline on the wire but is not a
+//     column: futures_klines holds the stored interval only, coarser ones are aggregated from it.
 //   - OpenPrice, HighPrice, LowPrice, ClosePrice: Standard OHLC values.
 //   - Volume: The base asset volume in this interval.
 //   - QuoteVolume: The quote asset volume in this interval.
 //   - Trades: The number of trades during this interval.
 //   - TakerBuyBaseVolume: The base volume where takers were the buyers.
 //   - TakerBuyQuoteVolume: The quote volume where takers were the buyers.
+//
+// Prices and volumes are exact decimals: they are parsed from the exchange's string
+// representation, stored as NUMERIC and serialised to JSON as strings, so no precision
+// is lost for low-priced tokens.
 type Kline struct {
-	Time                time.Time `json:"time"`
-	Symbol              string    `json:"symbol"`
-	OpenPrice           float64   `json:"open"`
-	HighPrice           float64   `json:"high"`
-	LowPrice            float64   `json:"low"`
-	ClosePrice          float64   `json:"close"`
-	Volume              float64   `json:"volume"`
-	QuoteVolume         float64   `json:"quote_volume"`
-	Trades              int64     `json:"trades"`
-	TakerBuyBaseVolume  float64   `json:"taker_buy_base_volume"`
-	TakerBuyQuoteVolume float64   `json:"taker_buy_quote_volume"`
+	Time                time.Time       `json:"time"`
+	CloseTime           time.Time       `json:"close_time"`
+	IsClosed            bool            `json:"is_closed"`
+	Exchange            string          `json:"exchange"`
+	Market              string          `json:"market"`
+	Symbol              string          `json:"symbol"`
+	Interval            string          `json:"interval,omitempty"`
+	OpenPrice           decimal.Decimal `json:"open"`
+	HighPrice           decimal.Decimal `json:"high"`
+	LowPrice            decimal.Decimal `json:"low"`
+	ClosePrice          decimal.Decimal `json:"close"`
+	Volume              decimal.Decimal `json:"volume"`
+	QuoteVolume         decimal.Decimal `json:"quote_volume"`
+	Trades              int64           `json:"trades"`
+	TakerBuyBaseVolume  decimal.Decimal `json:"taker_buy_base_volume"`
+	TakerBuyQuoteVolume decimal.Decimal `json:"taker_buy_quote_volume"`
 }
 
 // Validate checks if the Kline struct fields are within acceptable ranges
@@ -38,15 +55,41 @@ type Kline struct {
 func (k Kline) Validate() error {
 	return validation.ValidateStruct(&k,
 		validation.Field(&k.Time, validation.Required),
+		validation.Field(&k.CloseTime, validation.Required, validation.Min(k.Time)),
+		validation.Field(&k.Exchange, validation.Required),
+		validation.Field(&k.Market, validation.Required, validation.In(MarketSpot, MarketFutures)),
 		validation.Field(&k.Symbol, validation.Required),
-		validation.Field(&k.OpenPrice, validation.Required, validation.Min(0.0)),
-		validation.Field(&k.HighPrice, validation.Required, validation.Min(0.0)),
-		validation.Field(&k.LowPrice, validation.Required, validation.Min(0.0)),
-		validation.Field(&k.ClosePrice, validation.Required, validation.Min(0.0)),
-		validation.Field(&k.Volume, validation.Required, validation.Min(0.0)),
-		validation.Field(&k.QuoteVolume, validation.Required, validation.Min(0.0)),
+		validation.Field(&k.OpenPrice, validation.By(positiveDecimal)),
+		validation.Field(&k.HighPrice, validation.By(positiveDecimal)),
+		validation.Field(&k.LowPrice, validation.By(positiveDecimal)),
+		validation.Field(&k.ClosePrice, validation.By(positiveDecimal)),
+		validation.Field(&k.Volume, validation.By(positiveDecimal)),
+		validation.Field(&k.QuoteVolume, validation.By(positiveDecimal)),
 		validation.Field(&k.Trades, validation.Required, validation.Min(1)),
-		validation.Field(&k.TakerBuyBaseVolume, validation.Required, validation.Min(0.0)),
-		validation.Field(&k.TakerBuyQuoteVolume, validation.Required, validation.Min(0.0)),
+		validation.Field(&k.TakerBuyBaseVolume, validation.By(positiveDecimal)),
+		validation.Field(&k.TakerBuyQuoteVolume, validation.By(positiveDecimal)),
 	)
 }
+
+// positiveDecimal is a validation rule requiring a decimal.Decimal greater than zero.
+func positiveDecimal(value interface{}) error {
+	d, ok := value.(decimal.Decimal)
+	if !ok {
+		return errors.New("must be a decimal")
+	}
+	if !d.IsPositive() {
+		return errors.New("must be greater than zero")
+	}
+	return nil
+}
+
+// Instrument returns the series key of this kline.
+func (k Kline) Instrument() Instrument {
+	return Instrument{Exchange: k.Exchange, Market: k.Market, Symbol: k.Symbol}
+}
+
+// CloseTimeFor returns the close time of a candle opened at openTime with the given interval
+// length, following the exchange convention of the last millisecond within the candle.
+func CloseTimeFor(openTime time.Time, interval time.Duration) time.Time {
+	return openTime.Add(interval - time.Millisecond)
+}
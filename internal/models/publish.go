@@ -0,0 +1,21 @@
+package models
+
+// PublishAck describes where a published batch of klines landed in JetStream.
+type PublishAck struct {
+	// Stream is the JetStream stream that stored the messages.
+	Stream string `json:"stream"`
+	// Sequence is the stream sequence assigned to the last newly stored message.
+	Sequence uint64 `json:"seq"`
+	// Published is the number of messages the stream stored.
+	Published int `json:"published"`
+	// Duplicates is the number of messages the stream recognised as duplicates and did not store.
+	Duplicates int `json:"duplicates"`
+}
+
+// PublishStats are the publish counters accumulated since startup.
+type PublishStats struct {
+	// Published is the number of messages the stream stored.
+	Published uint64 `json:"published"`
+	// Duplicates is the number of messages dropped by the stream's duplicate window.
+	Duplicates uint64 `json:"duplicates"`
+}
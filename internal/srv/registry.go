@@ -0,0 +1,51 @@
+package srv
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ExchangeRegistry holds the ExchangeClient of every configured exchange, keyed by exchange name
+// (see the models.Exchange* constants). It is safe for concurrent use.
+type ExchangeRegistry struct {
+	mu      sync.RWMutex
+	clients map[string]ExchangeClient
+}
+
+// NewExchangeRegistry constructs an empty registry.
+func NewExchangeRegistry() *ExchangeRegistry {
+	return &ExchangeRegistry{clients: make(map[string]ExchangeClient)}
+}
+
+// Register adds (or replaces) the client for the given exchange name.
+func (r *ExchangeRegistry) Register(name string, client ExchangeClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[name] = client
+}
+
+// Get returns the client registered for the given exchange name.
+func (r *ExchangeRegistry) Get(name string) (ExchangeClient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	client, ok := r.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown exchange %q", name)
+	}
+	return client, nil
+}
+
+// Names returns the sorted names of all registered exchanges.
+func (r *ExchangeRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.clients))
+	for name := range r.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,71 +2,118 @@ package srv
 
 import (
 	"context"
+	"time"
 
 	"infosir/internal/models"
 )
 
-// BinanceClient is an interface that represents the minimal set of methods
-// needed from a Binance (or other exchange) client to fetch Klines data.
-type BinanceClient interface {
+// ExchangeClient is an exchange-agnostic interface that represents the minimal set of methods
+// needed from an exchange (Binance, Bybit, OKX, ...) client to fetch Klines data. Implementations
+// normalise the exchange's native format into models.Kline and use Binance interval notation.
+type ExchangeClient interface {
 	// FetchKlines retrieves up to 'limit' klines for the given trading pair and interval.
 	FetchKlines(ctx context.Context, pair, interval string, limit int64) ([]models.Kline, error)
+	// FetchKlinesRange retrieves up to 'limit' klines whose open time lies within [start, end].
+	// A zero start or end leaves that bound open.
+	FetchKlinesRange(ctx context.Context, pair, interval string, start, end time.Time, limit int64) ([]models.Kline, error)
 }
 
 // NatsClient is an interface representing publishing capabilities to NATS (JetStream).
 type NatsClient interface {
-	// PublishKlines publishes the given klines to the configured subject/stream in JetStream.
-	PublishKlines(ctx context.Context, klines []models.Kline) error
+	// PublishKlines publishes the given klines to the configured subject/stream in JetStream
+	// and returns the stream acknowledgement. Publishing no klines is a no-op with a zero ack.
+	PublishKlines(ctx context.Context, klines []models.Kline) (models.PublishAck, error)
 }
 
 // InfoSirService defines the high-level service interface for retrieving klines and
 // publishing them to JetStream or other messaging systems.
 type InfoSirService interface {
-	// GetKlines obtains the latest (limit) klines from the BinanceClient for the pair and interval.
-	GetKlines(ctx context.Context, pair, interval string, limit int64) ([]models.Kline, error)
-	// PublishKlinesJS publishes the given klines to NATS JetStream.
-	PublishKlinesJS(ctx context.Context, klines []models.Kline) error
+	// GetKlines obtains the latest (limit) klines from the given exchange for the pair and interval.
+	GetKlines(ctx context.Context, exchange, pair, interval string, limit int64) ([]models.Kline, error)
+	// GetKlinesRange obtains up to (limit) klines from the given exchange whose open time lies
+	// within [start, end]. A zero start or end leaves that bound open.
+	GetKlinesRange(ctx context.Context, exchange, pair, interval string, start, end time.Time, limit int64) ([]models.Kline, error)
+	// PublishKlinesJS publishes the given klines to NATS JetStream and returns the stream acknowledgement.
+	PublishKlinesJS(ctx context.Context, klines []models.Kline) (models.PublishAck, error)
 }
 
 // infoSirServiceImpl is the internal struct implementing the InfoSirService interface.
 type infoSirServiceImpl struct {
-	binanceClient BinanceClient
-	natsClient    NatsClient
+	exchanges  *ExchangeRegistry
+	natsClient NatsClient
 }
 
-// NewInfoSirService constructs an InfoSirService with the given Binance and NATS clients.
+// NewInfoSirService constructs an InfoSirService with the given exchange registry and NATS client.
 func NewInfoSirService(
-	binanceClient BinanceClient,
+	exchanges *ExchangeRegistry,
 	natsClient NatsClient,
 ) InfoSirService {
 	return &infoSirServiceImpl{
-		binanceClient: binanceClient,
-		natsClient:    natsClient,
+		exchanges:  exchanges,
+		natsClient: natsClient,
 	}
 }
 
 // GetKlines obtains the latest klines from the exchange for the specified pair, interval, and limit.
 func (s *infoSirServiceImpl) GetKlines(
 	ctx context.Context,
+	exchange string,
 	pair string,
 	interval string,
 	limit int64,
 ) ([]models.Kline, error) {
-	klines, err := s.binanceClient.FetchKlines(ctx, pair, interval, limit)
+	client, err := s.exchanges.Get(exchange)
 	if err != nil {
 		return nil, err
 	}
 
+	klines, err := client.FetchKlines(ctx, pair, interval, limit)
+	if err != nil {
+		return nil, err
+	}
+	tagInterval(klines, interval)
+
 	// Optionally validate each returned kline if needed
 	// e.g. for i, k := range klines { if err := k.Validate(); err != nil { ... } }
 
 	return klines, nil
 }
 
+// GetKlinesRange obtains the klines of the specified pair and interval within [start, end] from the exchange.
+func (s *infoSirServiceImpl) GetKlinesRange(
+	ctx context.Context,
+	exchange string,
+	pair string,
+	interval string,
+	start, end time.Time,
+	limit int64,
+) ([]models.Kline, error) {
+	client, err := s.exchanges.Get(exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	klines, err := client.FetchKlinesRange(ctx, pair, interval, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	tagInterval(klines, interval)
+
+	return klines, nil
+}
+
+// tagInterval records the requested interval on every kline, so that consumers can tell
+// candles of different intervals apart.
+func tagInterval(klines []models.Kline, interval string) {
+	for i := range klines {
+		klines[i].Interval = interval
+	}
+}
+
 // PublishKlinesJS publishes klines to NATS JetStream via the underlying natsClient.
 func (s *infoSirServiceImpl) PublishKlinesJS(
 	ctx context.Context,
 	klines []models.Kline,
-) error {
+) (models.PublishAck, error) {
 	return s.natsClient.PublishKlines(ctx, klines)
 }
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"infosir/internal/models"
@@ -19,6 +21,7 @@ type binanceClientImpl struct {
 	httpClient *http.Client
 	baseURL    string
 	klinesPath string
+	limiter    *WeightLimiter
 }
 
 // NewBinanceClient constructs a new Binance-like client using default baseURL and path from config.
@@ -31,6 +34,7 @@ func NewBinanceClient() *binanceClientImpl {
 		},
 		baseURL:    cfg.BinanceBaseURL,
 		klinesPath: cfg.BinanceKlinesPoint,
+		limiter:    LimiterFor(cfg.BinanceBaseURL, cfg.BinanceWeightLimit),
 	}
 }
 
@@ -41,88 +45,59 @@ func (b *binanceClientImpl) FetchKlines(
 	pair, interval string,
 	limit int64,
 ) ([]models.Kline, error) {
+	return b.FetchKlinesRange(ctx, pair, interval, time.Time{}, time.Time{}, limit)
+}
 
-	endpoint := fmt.Sprintf(
-		"%s/%s?symbol=%s&interval=%s&limit=%d",
-		b.baseURL,
-		b.klinesPath,
-		pair,
-		interval,
-		limit,
-	)
+// FetchKlinesRange retrieves up to 'limit' klines for the given trading pair and interval whose
+// open time lies within [start, end]. A zero start or end leaves that bound open, in which case
+// Binance returns the most recent klines. The returned slice is in ascending time order.
+func (b *binanceClientImpl) FetchKlinesRange(
+	ctx context.Context,
+	pair, interval string,
+	start, end time.Time,
+	limit int64,
+) ([]models.Kline, error) {
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create new request: %w", err)
+	params := url.Values{}
+	params.Set("symbol", pair)
+	params.Set("interval", interval)
+	params.Set("limit", strconv.FormatInt(limit, 10))
+	if !start.IsZero() {
+		params.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+	}
+	if !end.IsZero() {
+		params.Set("endTime", strconv.FormatInt(end.UnixMilli(), 10))
 	}
 
-	resp, err := b.httpClient.Do(req)
+	endpoint := fmt.Sprintf("%s/%s?%s", b.baseURL, b.klinesPath, params.Encode())
+
+	resp, err := doWithLimits(ctx, b.httpClient, b.limiter, endpoint, klinesWeight(b.klinesPath, limit), models.ExchangeBinance)
 	if err != nil {
-		return nil, fmt.Errorf("httpClient.Do error: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("fetchKlines received status %d from binance", resp.StatusCode)
-	}
-
 	// Binance returns klines as an array of arrays:
 	// e.g. [
 	//   [ 1499040000000, "0.01634790", "0.80000000", "0.01575800", "0.01577100", "148976.11427815", ... ],
 	//   ...
 	// ]
-	// We'll parse them accordingly.
+	// We'll parse them accordingly. Numbers are kept as json.Number so that nothing passes through float64.
 	var rawKlines [][]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&rawKlines); err != nil {
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&rawKlines); err != nil {
 		return nil, fmt.Errorf("failed to decode binance klines JSON: %w", err)
 	}
 
 	klines := make([]models.Kline, 0, len(rawKlines))
+	market := binanceMarket(b.klinesPath)
+	now := time.Now()
 
 	for _, raw := range rawKlines {
-		// We expect each raw to have length >= 11, e.g. openTime, openPrice, highPrice, lowPrice, closePrice, volume ...
-		// For reference, see Binance docs for the full structure
-		if len(raw) < 11 {
-			utils.Logger.Warn("Skipping malformed kline record", zap.Any("raw", raw))
-			continue
-		}
-
-		openTimeMs, _ := toInt64(raw[0])
-		openStr, _ := toString(raw[1])
-		highStr, _ := toString(raw[2])
-		lowStr, _ := toString(raw[3])
-		closeStr, _ := toString(raw[4])
-		volStr, _ := toString(raw[5])
-		// index 6 is quote volume
-		quoteVolStr, _ := toString(raw[7])
-		tradesCount, _ := toInt64(raw[8])
-		takerBuyBaseStr, _ := toString(raw[9])
-		takerBuyQuoteStr, _ := toString(raw[10])
-
-		// Convert strings to float64
-		openF, _ := strconv.ParseFloat(openStr, 64)
-		highF, _ := strconv.ParseFloat(highStr, 64)
-		lowF, _ := strconv.ParseFloat(lowStr, 64)
-		closeF, _ := strconv.ParseFloat(closeStr, 64)
-		volF, _ := strconv.ParseFloat(volStr, 64)
-		quoteVolF, _ := strconv.ParseFloat(quoteVolStr, 64)
-		takerBuyBaseF, _ := strconv.ParseFloat(takerBuyBaseStr, 64)
-		takerBuyQuoteF, _ := strconv.ParseFloat(takerBuyQuoteStr, 64)
-
-		openTime := time.Unix(0, openTimeMs*int64(time.Millisecond))
-
-		k := models.Kline{
-			Time:                openTime,
-			Symbol:              pair, // we store the exact pair as given
-			OpenPrice:           openF,
-			HighPrice:           highF,
-			LowPrice:            lowF,
-			ClosePrice:          closeF,
-			Volume:              volF,
-			QuoteVolume:         quoteVolF,
-			Trades:              tradesCount,
-			TakerBuyBaseVolume:  takerBuyBaseF,
-			TakerBuyQuoteVolume: takerBuyQuoteF,
+		k, err := parseBinanceKline(market, pair, raw, now)
+		if err != nil {
+			return nil, err
 		}
 		klines = append(klines, k)
 	}
@@ -135,6 +110,73 @@ func (b *binanceClientImpl) FetchKlines(
 	return klines, nil
 }
 
+// binanceMarket derives the market from the klines endpoint path: "fapi/..." (USD-M) and
+// "dapi/..." (COIN-M) are futures, everything else (e.g. "api/v3/klines") is spot.
+func binanceMarket(klinesPath string) string {
+	if strings.Contains(klinesPath, "fapi/") || strings.Contains(klinesPath, "dapi/") {
+		return models.MarketFutures
+	}
+	return models.MarketSpot
+}
+
+// parseBinanceKline converts one raw Binance kline array into a Kline:
+//
+//	[openTime, open, high, low, close, volume, closeTime, quoteVolume, trades,
+//	 takerBuyBaseVolume, takerBuyQuoteVolume, ignore]
+//
+// Any malformed field is reported as an error instead of silently becoming zero. A candle whose
+// close time is not yet in the past (the trailing one of the latest page) is marked as open.
+func parseBinanceKline(market, pair string, raw []interface{}, now time.Time) (models.Kline, error) {
+	// For reference, see Binance docs for the full structure
+	if len(raw) < 11 {
+		return models.Kline{}, fmt.Errorf("malformed binance kline record: %v", raw)
+	}
+
+	openTimeMs, ok := toInt64(raw[0])
+	if !ok {
+		return models.Kline{}, fmt.Errorf("invalid binance open time %v", raw[0])
+	}
+	closeTimeMs, ok := toInt64(raw[6])
+	if !ok {
+		return models.Kline{}, fmt.Errorf("invalid binance close time %v", raw[6])
+	}
+	tradesCount, ok := toInt64(raw[8])
+	if !ok {
+		return models.Kline{}, fmt.Errorf("invalid binance trades count %v", raw[8])
+	}
+
+	// open, high, low, close, volume, quote volume, taker buy base, taker buy quote
+	fields := make([]string, 0, 8)
+	for _, idx := range []int{1, 2, 3, 4, 5, 7, 9, 10} {
+		str, _ := toString(raw[idx])
+		fields = append(fields, str)
+	}
+	values, err := parseDecimals(fields)
+	if err != nil {
+		return models.Kline{}, fmt.Errorf("parse binance kline at %d: %w", openTimeMs, err)
+	}
+
+	closeTime := time.UnixMilli(closeTimeMs)
+
+	return models.Kline{
+		Time:                time.UnixMilli(openTimeMs),
+		CloseTime:           closeTime,
+		IsClosed:            closeTime.Before(now),
+		Exchange:            models.ExchangeBinance,
+		Market:              market,
+		Symbol:              pair, // we store the exact pair as given
+		OpenPrice:           values[0],
+		HighPrice:           values[1],
+		LowPrice:            values[2],
+		ClosePrice:          values[3],
+		Volume:              values[4],
+		QuoteVolume:         values[5],
+		Trades:              tradesCount,
+		TakerBuyBaseVolume:  values[6],
+		TakerBuyQuoteVolume: values[7],
+	}, nil
+}
+
 func toInt64(v interface{}) (int64, bool) {
 	switch val := v.(type) {
 	case float64:
@@ -145,6 +187,9 @@ func toInt64(v interface{}) (int64, bool) {
 		return int64(val), true
 	case int64:
 		return val, true
+	case json.Number:
+		res, err := val.Int64()
+		return res, (err == nil)
 	case string:
 		res, err := strconv.ParseInt(val, 10, 64)
 		return res, (err == nil)
@@ -0,0 +1,270 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// wsMaxConnLifetime is how long we keep a single connection. Binance drops every
+	// connection after 24h, so we reconnect proactively a bit earlier.
+	wsMaxConnLifetime = 23*time.Hour + 50*time.Minute
+	// wsPongWait is how long we tolerate silence (no data and no ping) before considering
+	// the connection dead. Binance pings every 3 minutes on futures and every 20s on spot.
+	wsPongWait = 10 * time.Minute
+	// wsWriteWait bounds writes of control frames and subscription requests.
+	wsWriteWait = 10 * time.Second
+	// wsMinReconnectDelay and wsMaxReconnectDelay bound the exponential reconnect back-off.
+	wsMinReconnectDelay = 1 * time.Second
+	wsMaxReconnectDelay = 30 * time.Second
+)
+
+// errConnLifetimeExceeded signals a planned reconnect before Binance's 24h cut-off.
+var errConnLifetimeExceeded = errors.New("websocket connection lifetime exceeded")
+
+// KlineHandler is invoked for every kline event received from the stream.
+// k.IsClosed reports whether the candle is final or still forming.
+type KlineHandler func(ctx context.Context, k models.Kline)
+
+// BinanceStreamClient consumes Binance combined kline streams (<symbol>@kline_<interval>)
+// over a WebSocket connection. It answers pings, reconnects with back-off on failures,
+// rotates the connection before the 24h limit and resubscribes after every reconnect.
+type BinanceStreamClient struct {
+	wsURL   string
+	market  string
+	streams []string
+	dialer  *websocket.Dialer
+
+	maxConnLifetime time.Duration
+	requestID       atomic.Int64
+}
+
+// NewBinanceStreamClient constructs a stream client for the given pairs and interval using the
+// WebSocket URL from config, e.g. "wss://fstream.binance.com/stream".
+func NewBinanceStreamClient(pairs []string, interval string) *BinanceStreamClient {
+	streams := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		streams = append(streams, fmt.Sprintf("%s@kline_%s", strings.ToLower(pair), interval))
+	}
+
+	return &BinanceStreamClient{
+		wsURL:           utils.GetConfig().Crypto.BinanceWSURL,
+		market:          binanceStreamMarket(utils.GetConfig().Crypto.BinanceWSURL),
+		streams:         streams,
+		dialer:          websocket.DefaultDialer,
+		maxConnLifetime: wsMaxConnLifetime,
+	}
+}
+
+// Streams returns the stream names this client subscribes to.
+func (c *BinanceStreamClient) Streams() []string {
+	return c.streams
+}
+
+// Run connects to the stream and dispatches kline events to handler until ctx is cancelled.
+// Connection failures and planned rotations lead to a reconnect and resubscription.
+func (c *BinanceStreamClient) Run(ctx context.Context, handler KlineHandler) error {
+	delay := wsMinReconnectDelay
+
+	for {
+		connected, err := c.runOnce(ctx, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if connected {
+			// The connection worked at some point; start the back-off from scratch.
+			delay = wsMinReconnectDelay
+		}
+		if errors.Is(err, errConnLifetimeExceeded) {
+			utils.Logger.Info("Rotating Binance websocket connection", zap.Strings("streams", c.streams))
+			continue
+		}
+
+		utils.Logger.Warn("Binance websocket disconnected; reconnecting",
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > wsMaxReconnectDelay {
+			delay = wsMaxReconnectDelay
+		}
+	}
+}
+
+// runOnce serves a single connection until it fails, its lifetime expires or ctx is cancelled.
+// The returned bool reports whether the connection was established and subscribed.
+func (c *BinanceStreamClient) runOnce(ctx context.Context, handler KlineHandler) (bool, error) {
+	conn, _, err := c.dialer.DialContext(ctx, c.wsURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("websocket dial: %w", err)
+	}
+	defer conn.Close()
+
+	// Reading blocks, so we close the connection from the outside on cancellation or rotation.
+	var rotated atomic.Bool
+	lifetime := time.AfterFunc(c.maxConnLifetime, func() {
+		rotated.Store(true)
+		_ = conn.Close()
+	})
+	defer lifetime.Stop()
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPingHandler(func(appData string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(wsWriteWait))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+		return err
+	})
+
+	if err := c.subscribe(conn); err != nil {
+		return false, err
+	}
+
+	utils.Logger.Info("Subscribed to Binance kline streams", zap.Strings("streams", c.streams))
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if rotated.Load() {
+				return true, errConnLifetimeExceeded
+			}
+			return true, fmt.Errorf("websocket read: %w", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		k, ok, err := parseStreamMessage(c.market, data)
+		if err != nil {
+			utils.Logger.Warn("Skipping malformed websocket message", zap.ByteString("data", data), zap.Error(err))
+			continue
+		}
+		if ok {
+			handler(ctx, k)
+		}
+	}
+}
+
+// subscribe sends a SUBSCRIBE request for all configured streams.
+func (c *BinanceStreamClient) subscribe(conn *websocket.Conn) error {
+	req := struct {
+		Method string   `json:"method"`
+		Params []string `json:"params"`
+		ID     int64    `json:"id"`
+	}{
+		Method: "SUBSCRIBE",
+		Params: c.streams,
+		ID:     c.requestID.Add(1),
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := conn.WriteJSON(req); err != nil {
+		return fmt.Errorf("websocket subscribe: %w", err)
+	}
+	return nil
+}
+
+// binanceStreamMarket derives the market from the WebSocket URL: the "fstream" (USD-M) and
+// "dstream" (COIN-M) hosts serve futures, everything else spot.
+func binanceStreamMarket(wsURL string) string {
+	if strings.Contains(wsURL, "fstream") || strings.Contains(wsURL, "dstream") {
+		return models.MarketFutures
+	}
+	return models.MarketSpot
+}
+
+// wsKlineEvent mirrors the payload of a combined-stream kline event:
+//
+//	{"stream":"btcusdt@kline_1m","data":{"e":"kline","E":123,"s":"BTCUSDT","k":{"t":...,"o":"...",...}}}
+type wsKlineEvent struct {
+	Stream string `json:"stream"`
+	Data   struct {
+		// Binance uses keys differing only in case ("e"/"E", "t"/"T", ...). encoding/json matches
+		// keys case-insensitively when there is no exact match, so every key we may receive
+		// must have its own field.
+		EventType string `json:"e"`
+		EventTime int64  `json:"E"`
+		Symbol    string `json:"s"`
+		Kline     struct {
+			OpenTime            int64  `json:"t"`
+			CloseTime           int64  `json:"T"`
+			Symbol              string `json:"s"`
+			Interval            string `json:"i"`
+			FirstTradeID        int64  `json:"f"`
+			LastTradeID         int64  `json:"L"`
+			Open                string `json:"o"`
+			Close               string `json:"c"`
+			High                string `json:"h"`
+			Low                 string `json:"l"`
+			Volume              string `json:"v"`
+			Trades              int64  `json:"n"`
+			Closed              bool   `json:"x"`
+			QuoteVolume         string `json:"q"`
+			TakerBuyBaseVolume  string `json:"V"`
+			TakerBuyQuoteVolume string `json:"Q"`
+			Ignore              string `json:"B"`
+		} `json:"k"`
+	} `json:"data"`
+}
+
+// parseStreamMessage converts a raw stream message into a Kline. ok is false for messages
+// that are not kline events, e.g. subscription acknowledgements like {"result":null,"id":1}.
+func parseStreamMessage(market string, data []byte) (k models.Kline, ok bool, err error) {
+	var ev wsKlineEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return k, false, fmt.Errorf("decode websocket message: %w", err)
+	}
+	if ev.Data.EventType != "kline" {
+		return k, false, nil
+	}
+
+	raw := ev.Data.Kline
+	values, err := parseDecimals([]string{
+		raw.Open, raw.High, raw.Low, raw.Close,
+		raw.Volume, raw.QuoteVolume, raw.TakerBuyBaseVolume, raw.TakerBuyQuoteVolume,
+	})
+	if err != nil {
+		return k, false, fmt.Errorf("parse kline event: %w", err)
+	}
+
+	k = models.Kline{
+		Time:                time.UnixMilli(raw.OpenTime),
+		CloseTime:           time.UnixMilli(raw.CloseTime),
+		IsClosed:            raw.Closed,
+		Exchange:            models.ExchangeBinance,
+		Market:              market,
+		Symbol:              ev.Data.Symbol,
+		Interval:            raw.Interval,
+		OpenPrice:           values[0],
+		HighPrice:           values[1],
+		LowPrice:            values[2],
+		ClosePrice:          values[3],
+		Volume:              values[4],
+		QuoteVolume:         values[5],
+		Trades:              raw.Trades,
+		TakerBuyBaseVolume:  values[6],
+		TakerBuyQuoteVolume: values[7],
+	}
+	return k, true, nil
+}
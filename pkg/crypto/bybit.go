@@ -0,0 +1,197 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// bybitMaxLimit is the maximum number of klines Bybit returns per request.
+const bybitMaxLimit = 1000
+
+// bybitIntervals maps our (Binance-style) intervals to Bybit v5 notation.
+var bybitIntervals = map[string]string{
+	"1m": "1", "3m": "3", "5m": "5", "15m": "15", "30m": "30",
+	"1h": "60", "2h": "120", "4h": "240", "6h": "360", "12h": "720",
+	"1d": "D", "1w": "W",
+}
+
+// bybitClientImpl is an ExchangeClient for the Bybit v5 market kline REST endpoint.
+type bybitClientImpl struct {
+	httpClient *http.Client
+	baseURL    string
+	category   string
+	limiter    *WeightLimiter
+}
+
+// NewBybitClient constructs a Bybit kline client using the base URL and category from config.
+func NewBybitClient() *bybitClientImpl {
+	cfg := utils.GetConfig().Crypto
+
+	return &bybitClientImpl{
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		baseURL:  cfg.BybitBaseURL,
+		category: cfg.BybitCategory,
+		limiter:  LimiterFor(cfg.BybitBaseURL, cfg.BybitRequestLimit),
+	}
+}
+
+// bybitKlineResponse mirrors the Bybit v5 /v5/market/kline response:
+//
+//	{"retCode":0,"retMsg":"OK","result":{"symbol":"BTCUSDT","list":[["1704067200000","42000","42020","41990","42010","12.5","525000"],...]}}
+//
+// The list is sorted newest first.
+type bybitKlineResponse struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		Symbol string     `json:"symbol"`
+		List   [][]string `json:"list"`
+	} `json:"result"`
+}
+
+// FetchKlines retrieves up to 'limit' latest klines for the given symbol and interval from Bybit.
+func (b *bybitClientImpl) FetchKlines(
+	ctx context.Context,
+	pair, interval string,
+	limit int64,
+) ([]models.Kline, error) {
+	return b.FetchKlinesRange(ctx, pair, interval, time.Time{}, time.Time{}, limit)
+}
+
+// FetchKlinesRange retrieves up to 'limit' klines with open time within [start, end] from Bybit.
+// Because Bybit returns the newest klines of a window, the window is capped to 'limit' candles
+// past start so that forward pagination does not skip data. The result is in ascending order.
+func (b *bybitClientImpl) FetchKlinesRange(
+	ctx context.Context,
+	pair, interval string,
+	start, end time.Time,
+	limit int64,
+) ([]models.Kline, error) {
+	bybitInterval, ok := bybitIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("interval %q is not supported by bybit", interval)
+	}
+	if limit > bybitMaxLimit {
+		limit = bybitMaxLimit
+	}
+	iv, _ := models.ParseInterval(interval)
+
+	params := url.Values{}
+	params.Set("category", b.category)
+	params.Set("symbol", pair)
+	params.Set("interval", bybitInterval)
+	params.Set("limit", strconv.FormatInt(limit, 10))
+	if !start.IsZero() {
+		end = cappedWindow(start, end, iv.Duration(), limit)
+		params.Set("start", strconv.FormatInt(start.UnixMilli(), 10))
+	}
+	if !end.IsZero() {
+		params.Set("end", strconv.FormatInt(end.UnixMilli(), 10))
+	}
+
+	endpoint := fmt.Sprintf("%s/v5/market/kline?%s", b.baseURL, params.Encode())
+
+	resp, err := doWithLimits(ctx, b.httpClient, b.limiter, endpoint, 1, models.ExchangeBybit)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body bybitKlineResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode bybit klines JSON: %w", err)
+	}
+	if body.RetCode != 0 {
+		return nil, fmt.Errorf("bybit error %d: %s", body.RetCode, body.RetMsg)
+	}
+
+	market := bybitMarket(b.category)
+	now := time.Now()
+	klines := make([]models.Kline, 0, len(body.Result.List))
+	for i := len(body.Result.List) - 1; i >= 0; i-- {
+		k, err := parseBybitKline(market, pair, iv.Duration(), body.Result.List[i], now)
+		if err != nil {
+			return nil, err
+		}
+		klines = append(klines, k)
+	}
+
+	utils.Logger.Debug("Fetched klines from bybit",
+		zap.String("pair", pair),
+		zap.Int("count", len(klines)),
+	)
+
+	return klines, nil
+}
+
+// parseBybitKline converts a single Bybit list entry
+// [startTime, open, high, low, close, volume, turnover] into a Kline.
+// Bybit does not report trade counts, taker volumes or close times: the former stay zero and
+// the close time is derived from the interval; candles closing in the future are marked as open.
+func parseBybitKline(market, pair string, step time.Duration, raw []string, now time.Time) (models.Kline, error) {
+	if len(raw) < 7 {
+		return models.Kline{}, fmt.Errorf("malformed bybit kline record: %v", raw)
+	}
+
+	openTimeMs, err := strconv.ParseInt(raw[0], 10, 64)
+	if err != nil {
+		return models.Kline{}, fmt.Errorf("parse bybit open time %q: %w", raw[0], err)
+	}
+	values, err := parseDecimals(raw[1:7])
+	if err != nil {
+		return models.Kline{}, fmt.Errorf("parse bybit kline: %w", err)
+	}
+
+	openTime := time.UnixMilli(openTimeMs)
+	closeTime := models.CloseTimeFor(openTime, step)
+
+	return models.Kline{
+		Time:        openTime,
+		CloseTime:   closeTime,
+		IsClosed:    closeTime.Before(now),
+		Exchange:    models.ExchangeBybit,
+		Market:      market,
+		Symbol:      pair,
+		OpenPrice:   values[0],
+		HighPrice:   values[1],
+		LowPrice:    values[2],
+		ClosePrice:  values[3],
+		Volume:      values[4],
+		QuoteVolume: values[5],
+	}, nil
+}
+
+// bybitMarket maps a Bybit product category to a market: "spot" is spot, while
+// "linear" and "inverse" are futures.
+func bybitMarket(category string) string {
+	if category == "spot" {
+		return models.MarketSpot
+	}
+	return models.MarketFutures
+}
+
+// parseDecimals parses every string as an exact decimal, failing on the first invalid value.
+func parseDecimals(raw []string) ([]decimal.Decimal, error) {
+	values := make([]decimal.Decimal, len(raw))
+	for i, s := range raw {
+		v, err := decimal.NewFromString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %w", s, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxRequestAttempts bounds how often a single request is retried after a 429/418 back-off.
+const maxRequestAttempts = 3
+
+// doWithLimits sends a GET request through the shared weight limiter. Rate limit responses
+// (429/418) make every caller of the limiter back off for Retry-After, after which the
+// request is retried up to maxRequestAttempts times. Any other non-200 status is an error.
+// On success the caller owns (and must close) the response body.
+func doWithLimits(
+	ctx context.Context,
+	httpClient *http.Client,
+	limiter *WeightLimiter,
+	endpoint string,
+	weight int,
+	exchange string,
+) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if err := limiter.Wait(ctx, weight); err != nil {
+			return nil, fmt.Errorf("rate limiter wait: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new request: %w", err)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("httpClient.Do error: %w", err)
+		}
+		limiter.Observe(resp.Header)
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return resp, nil
+		case http.StatusTooManyRequests, http.StatusTeapot:
+			resp.Body.Close()
+			limiter.backoffFromResponse(resp)
+			if attempt >= maxRequestAttempts {
+				return nil, fmt.Errorf("%s rate limit: status %d after %d attempts", exchange, resp.StatusCode, attempt)
+			}
+		default:
+			resp.Body.Close()
+			return nil, fmt.Errorf("fetchKlines received status %d from %s", resp.StatusCode, exchange)
+		}
+	}
+}
+
+// cappedWindow limits [start, end] to at most 'limit' candles of the given step. Exchanges like
+// Bybit and OKX return the newest candles of the requested window, so a forward walk only works
+// if every window fits into a single page.
+func cappedWindow(start, end time.Time, step time.Duration, limit int64) time.Time {
+	windowEnd := start.Add(time.Duration(limit-1) * step)
+	if end.IsZero() || windowEnd.Before(end) {
+		return windowEnd
+	}
+	return end
+}
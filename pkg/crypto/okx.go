@@ -0,0 +1,199 @@
+package crypto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// okxMaxLimit is the maximum number of klines the OKX history-candles endpoint returns per request.
+const okxMaxLimit = 100
+
+// okxBars maps our (Binance-style) intervals to OKX bar notation. Intervals of 6h and above
+// use the UTC-aligned variants so that candles line up with the other exchanges.
+var okxBars = map[string]string{
+	"1m": "1m", "3m": "3m", "5m": "5m", "15m": "15m", "30m": "30m",
+	"1h": "1H", "2h": "2H", "4h": "4H", "6h": "6Hutc", "12h": "12Hutc",
+	"1d": "1Dutc", "1w": "1Wutc",
+}
+
+// okxClientImpl is an ExchangeClient for the OKX v5 history-candles REST endpoint.
+// Pairs are OKX instrument IDs, e.g. "BTC-USDT-SWAP".
+type okxClientImpl struct {
+	httpClient *http.Client
+	baseURL    string
+	limiter    *WeightLimiter
+}
+
+// NewOKXClient constructs an OKX kline client using the base URL from config.
+func NewOKXClient() *okxClientImpl {
+	cfg := utils.GetConfig().Crypto
+
+	return &okxClientImpl{
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		baseURL: cfg.OKXBaseURL,
+		limiter: LimiterFor(cfg.OKXBaseURL, cfg.OKXRequestLimit),
+	}
+}
+
+// okxCandlesResponse mirrors the OKX /api/v5/market/history-candles response:
+//
+//	{"code":"0","msg":"","data":[["1704067200000","42000","42020","41990","42010","125","12.5","525000","1"],...]}
+//
+// Each entry is [ts, o, h, l, c, vol, volCcy, volCcyQuote, confirm], sorted newest first.
+type okxCandlesResponse struct {
+	Code string     `json:"code"`
+	Msg  string     `json:"msg"`
+	Data [][]string `json:"data"`
+}
+
+// FetchKlines retrieves up to 'limit' latest klines for the given instrument and interval from OKX.
+func (o *okxClientImpl) FetchKlines(
+	ctx context.Context,
+	pair, interval string,
+	limit int64,
+) ([]models.Kline, error) {
+	return o.FetchKlinesRange(ctx, pair, interval, time.Time{}, time.Time{}, limit)
+}
+
+// FetchKlinesRange retrieves up to 'limit' klines with open time within [start, end] from OKX.
+// OKX pages backwards from 'after', so the window is capped to 'limit' candles past start to keep
+// forward pagination gap-free. The result is in ascending order.
+func (o *okxClientImpl) FetchKlinesRange(
+	ctx context.Context,
+	pair, interval string,
+	start, end time.Time,
+	limit int64,
+) ([]models.Kline, error) {
+	bar, ok := okxBars[interval]
+	if !ok {
+		return nil, fmt.Errorf("interval %q is not supported by okx", interval)
+	}
+	if limit > okxMaxLimit {
+		limit = okxMaxLimit
+	}
+	iv, _ := models.ParseInterval(interval)
+
+	params := url.Values{}
+	params.Set("instId", pair)
+	params.Set("bar", bar)
+	params.Set("limit", strconv.FormatInt(limit, 10))
+	// "after" returns records older than the given ts, "before" records newer than it (both exclusive).
+	if !start.IsZero() {
+		end = cappedWindow(start, end, iv.Duration(), limit)
+		params.Set("before", strconv.FormatInt(start.UnixMilli()-1, 10))
+	}
+	if !end.IsZero() {
+		params.Set("after", strconv.FormatInt(end.UnixMilli()+1, 10))
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v5/market/history-candles?%s", o.baseURL, params.Encode())
+
+	resp, err := doWithLimits(ctx, o.httpClient, o.limiter, endpoint, 1, models.ExchangeOKX)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body okxCandlesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode okx candles JSON: %w", err)
+	}
+	if body.Code != "0" {
+		return nil, fmt.Errorf("okx error %s: %s", body.Code, body.Msg)
+	}
+
+	klines := make([]models.Kline, 0, len(body.Data))
+	for i := len(body.Data) - 1; i >= 0; i-- {
+		k, err := parseOKXCandle(pair, iv.Duration(), body.Data[i])
+		if err != nil {
+			return nil, err
+		}
+		klines = append(klines, k)
+	}
+
+	utils.Logger.Debug("Fetched klines from okx",
+		zap.String("pair", pair),
+		zap.Int("count", len(klines)),
+	)
+
+	return klines, nil
+}
+
+// parseOKXCandle converts a single OKX candle entry into a Kline. The candle reports vol, volCcy and
+// volCcyQuote, whose units depend on the instrument: for spot, vol is in base currency and volCcy in
+// quote currency; for derivatives, vol counts contracts and volCcy is in base currency. Volume is
+// therefore vol for spot and volCcy otherwise, and the quote volume is always volCcyQuote.
+// The close time is derived from the interval and the confirm flag ("1") marks closed candles.
+// OKX does not report trade counts or taker volumes; those stay zero.
+func parseOKXCandle(instID string, step time.Duration, raw []string) (models.Kline, error) {
+	if len(raw) < 9 {
+		return models.Kline{}, fmt.Errorf("malformed okx candle record: %v", raw)
+	}
+
+	openTimeMs, err := strconv.ParseInt(raw[0], 10, 64)
+	if err != nil {
+		return models.Kline{}, fmt.Errorf("parse okx open time %q: %w", raw[0], err)
+	}
+	prices, err := parseDecimals(raw[1:5])
+	if err != nil {
+		return models.Kline{}, fmt.Errorf("parse okx candle: %w", err)
+	}
+	market := okxMarket(instID)
+	baseVolume := raw[6]
+	if market == models.MarketSpot {
+		baseVolume = raw[5]
+	}
+	volumes, err := parseDecimals([]string{baseVolume, raw[7]})
+	if err != nil {
+		return models.Kline{}, fmt.Errorf("parse okx candle: %w", err)
+	}
+
+	openTime := time.UnixMilli(openTimeMs)
+
+	return models.Kline{
+		Time:        openTime,
+		CloseTime:   models.CloseTimeFor(openTime, step),
+		IsClosed:    raw[8] == "1",
+		Exchange:    models.ExchangeOKX,
+		Market:      market,
+		Symbol:      OKXSymbol(instID),
+		OpenPrice:   prices[0],
+		HighPrice:   prices[1],
+		LowPrice:    prices[2],
+		ClosePrice:  prices[3],
+		Volume:      volumes[0],
+		QuoteVolume: volumes[1],
+	}, nil
+}
+
+// OKXSymbol normalises an OKX instrument ID like "BTC-USDT-SWAP" into the exchange-agnostic
+// symbol notation used across the application, e.g. "BTCUSDT".
+func OKXSymbol(instID string) string {
+	parts := strings.Split(instID, "-")
+	if len(parts) >= 2 {
+		return parts[0] + parts[1]
+	}
+	return instID
+}
+
+// okxMarket derives the market from an OKX instrument ID: "BTC-USDT" is spot, while swaps
+// ("BTC-USDT-SWAP") and delivery futures ("BTC-USD-240329") are futures.
+func okxMarket(instID string) string {
+	if strings.Count(instID, "-") == 1 {
+		return models.MarketSpot
+	}
+	return models.MarketFutures
+}
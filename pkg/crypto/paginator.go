@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/srv"
+)
+
+// KlinePaginator walks a [start, end] time range forward, fetching klines chunk by chunk
+// through FetchKlinesRange until the end bound is reached. Windows without any data (e.g. before
+// a pair was listed on exchanges that page by window) are skipped.
+//
+// Typical usage:
+//
+//	p, err := crypto.NewKlinePaginator(client, "binance", "BTCUSDT", "1m", from, to, 1000)
+//	for p.Next(ctx) {
+//		klines := p.Klines()
+//		...
+//	}
+//	if err := p.Err(); err != nil { ... }
+type KlinePaginator struct {
+	client   srv.ExchangeClient
+	pair     string
+	interval string
+	step     time.Duration
+	cursor   time.Time
+	end      time.Time
+	limit    int64
+
+	page []models.Kline
+	err  error
+}
+
+// NewKlinePaginator constructs a paginator for the given pair and interval over [start, end].
+// 'limit' is the chunk size of every single request; it is capped to what the exchange allows per
+// request (MaxKlinesLimit), as clients cap it silently and empty windows are skipped by that size.
+func NewKlinePaginator(
+	client srv.ExchangeClient,
+	exchange, pair, interval string,
+	start, end time.Time,
+	limit int64,
+) (*KlinePaginator, error) {
+	iv, err := models.ParseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid chunk limit %d", limit)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end %s is before start %s", end, start)
+	}
+	if maxLimit := MaxKlinesLimit(exchange); limit > maxLimit {
+		limit = maxLimit
+	}
+
+	return &KlinePaginator{
+		client:   client,
+		pair:     pair,
+		interval: interval,
+		step:     iv.Duration(),
+		cursor:   start,
+		end:      end,
+		limit:    limit,
+	}, nil
+}
+
+// Next fetches the next non-empty chunk. It returns false when the range is exhausted or an error
+// occurred; the error, if any, is available via Err.
+func (p *KlinePaginator) Next(ctx context.Context) bool {
+	if p.err != nil {
+		return false
+	}
+
+	for !p.cursor.After(p.end) {
+		klines, err := p.client.FetchKlinesRange(ctx, p.pair, p.interval, p.cursor, p.end, p.limit)
+		if err != nil {
+			p.err = fmt.Errorf("fetch %s %s from %s: %w", p.pair, p.interval, p.cursor.UTC(), err)
+			return false
+		}
+		if len(klines) == 0 {
+			// Nothing in this window; move on by one full page.
+			p.cursor = p.cursor.Add(time.Duration(p.limit) * p.step)
+			continue
+		}
+
+		next := klines[len(klines)-1].Time.Add(p.step)
+		if !next.After(p.cursor) {
+			// The exchange returned nothing newer than the cursor; bail out instead of looping forever.
+			p.err = fmt.Errorf("pagination for %s %s stalled at %s", p.pair, p.interval, p.cursor.UTC())
+			return false
+		}
+
+		p.page = klines
+		p.cursor = next
+		return true
+	}
+
+	return false
+}
+
+// Klines returns the chunk fetched by the most recent successful call to Next.
+func (p *KlinePaginator) Klines() []models.Kline {
+	return p.page
+}
+
+// Cursor returns the open time the next chunk will start from.
+func (p *KlinePaginator) Cursor() time.Time {
+	return p.cursor
+}
+
+// Err returns the first error encountered while paginating.
+func (p *KlinePaginator) Err() error {
+	return p.err
+}
@@ -0,0 +1,202 @@
+package crypto
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// headerUsedWeight1m is the response header in which Binance reports the IP's used weight
+	// within the current one-minute window.
+	headerUsedWeight1m = "X-MBX-USED-WEIGHT-1M"
+
+	// defaultRateLimitBackoff is used when a 429 response carries no Retry-After header.
+	defaultRateLimitBackoff = time.Minute
+	// defaultBanBackoff is used when a 418 (IP banned) response carries no Retry-After header.
+	defaultBanBackoff = 2 * time.Minute
+)
+
+// WeightLimiter is a request-weight aware limiter modelled after Binance's IP limits:
+// every request costs a weight and the sum of weights per one-minute window must stay
+// below the configured maximum. Callers block in Wait until their weight fits into the
+// current window or any 429/418 back-off has expired.
+//
+// The limiter is safe for concurrent use and is meant to be shared by every component
+// talking to the same host (see LimiterFor).
+type WeightLimiter struct {
+	mu           sync.Mutex
+	maxWeight    int
+	used         int
+	window       time.Time // start of the current one-minute window
+	blockedUntil time.Time
+	now          func() time.Time
+}
+
+// NewWeightLimiter constructs a limiter allowing at most maxWeight per minute.
+func NewWeightLimiter(maxWeight int) *WeightLimiter {
+	return &WeightLimiter{maxWeight: maxWeight, now: time.Now}
+}
+
+// WithClock makes the limiter read the time from now instead of the wall clock, so that tests can
+// control the minute windows. It returns the limiter.
+func (l *WeightLimiter) WithClock(now func() time.Time) *WeightLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+	return l
+}
+
+// Wait blocks until a request with the given weight may be sent, then reserves that weight.
+// It returns early with ctx.Err() if the context is cancelled.
+func (l *WeightLimiter) Wait(ctx context.Context, weight int) error {
+	for {
+		delay := l.reserve(weight)
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve either reserves the weight and returns 0, or returns how long the caller should sleep.
+func (l *WeightLimiter) reserve(weight int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+
+	l.rollWindow(now)
+	// A single request heavier than the whole budget is let through on an empty window,
+	// otherwise it would block forever.
+	if l.used > 0 && l.used+weight > l.maxWeight {
+		return l.window.Add(time.Minute).Sub(now)
+	}
+
+	l.used += weight
+	return 0
+}
+
+// Observe updates the limiter from the weight usage reported by the exchange in the response headers.
+// The exchange's number is authoritative, but we never lower a count that already includes
+// reservations of requests still in flight.
+func (l *WeightLimiter) Observe(h http.Header) {
+	raw := h.Get(headerUsedWeight1m)
+	if raw == "" {
+		return
+	}
+	used, err := strconv.Atoi(raw)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollWindow(l.now())
+	if used > l.used {
+		l.used = used
+	}
+}
+
+// Backoff blocks all callers for the given duration, e.g. after a 429 or 418 response.
+func (l *WeightLimiter) Backoff(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := l.now().Add(d)
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// rollWindow resets the used weight once a new minute window has started. Binance counts
+// weight per calendar minute, so windows are aligned to minute boundaries.
+func (l *WeightLimiter) rollWindow(now time.Time) {
+	window := now.Truncate(time.Minute)
+	if window.After(l.window) {
+		l.window = window
+		l.used = 0
+	}
+}
+
+// backoffFromResponse handles a 429/418 response: it derives the back-off from Retry-After
+// (falling back to sane defaults), applies it to the limiter and returns it.
+func (l *WeightLimiter) backoffFromResponse(resp *http.Response) time.Duration {
+	d := defaultRateLimitBackoff
+	if resp.StatusCode == http.StatusTeapot {
+		d = defaultBanBackoff
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+		d = time.Duration(secs) * time.Second
+	}
+
+	l.Backoff(d)
+	utils.Logger.Warn("Exchange rate limit hit; backing off",
+		zap.Int("status", resp.StatusCode),
+		zap.Duration("backoff", d))
+	return d
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*WeightLimiter{}
+)
+
+// LimiterFor returns the process-wide limiter for the host of baseURL, creating it with
+// maxWeight on first use. All clients talking to the same host share one limiter, because
+// the exchange counts weight per IP rather than per client.
+func LimiterFor(baseURL string, maxWeight int) *WeightLimiter {
+	host := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	l, ok := limiters[host]
+	if !ok {
+		l = NewWeightLimiter(maxWeight)
+		limiters[host] = l
+	}
+	return l
+}
+
+// klinesWeight returns the request weight of a klines call for the given endpoint path and limit,
+// following the Binance documentation for spot and USD-M/COIN-M futures.
+func klinesWeight(path string, limit int64) int {
+	if binanceMarket(path) == models.MarketSpot {
+		// Spot klines have a flat weight.
+		return 2
+	}
+
+	switch {
+	case limit < 100:
+		return 1
+	case limit < 500:
+		return 2
+	case limit <= 1000:
+		return 5
+	default:
+		return 10
+	}
+}
@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"infosir/internal/models"
+	"infosir/internal/srv"
+	"infosir/internal/utils"
+)
+
+// NewExchangeRegistry builds a registry with a client for Binance and for every other exchange
+// that has pairs configured in CryptoConfig.
+func NewExchangeRegistry() *srv.ExchangeRegistry {
+	pairs := utils.GetConfig().Crypto.PairsByExchange()
+
+	registry := srv.NewExchangeRegistry()
+	registry.Register(models.ExchangeBinance, NewBinanceClient())
+	if len(pairs[models.ExchangeBybit]) > 0 {
+		registry.Register(models.ExchangeBybit, NewBybitClient())
+	}
+	if len(pairs[models.ExchangeOKX]) > 0 {
+		registry.Register(models.ExchangeOKX, NewOKXClient())
+	}
+	return registry
+}
+
+// InstrumentFor returns the series key under which klines of a pair, as configured for the given
+// exchange, are stored. The market is derived from the exchange configuration, and the symbol is
+// normalised, e.g. OKX's "BTC-USDT-SWAP" becomes {okx, futures, BTCUSDT}.
+func InstrumentFor(exchange, pair string) models.Instrument {
+	cfg := utils.GetConfig().Crypto
+
+	switch exchange {
+	case models.ExchangeBinance:
+		return models.Instrument{Exchange: exchange, Market: binanceMarket(cfg.BinanceKlinesPoint), Symbol: pair}
+	case models.ExchangeBybit:
+		return models.Instrument{Exchange: exchange, Market: bybitMarket(cfg.BybitCategory), Symbol: pair}
+	case models.ExchangeOKX:
+		return models.Instrument{Exchange: exchange, Market: okxMarket(pair), Symbol: OKXSymbol(pair)}
+	default:
+		return models.Instrument{Exchange: exchange, Market: models.MarketSpot, Symbol: pair}
+	}
+}
+
+// Binance accepts up to 1500 klines per request on futures endpoints and up to 1000 on spot.
+const (
+	binanceFuturesMaxLimit = 1500
+	binanceSpotMaxLimit    = 1000
+)
+
+// MaxKlinesLimit returns the maximum number of klines a single request to the given exchange,
+// as configured, may ask for.
+func MaxKlinesLimit(exchange string) int64 {
+	switch exchange {
+	case models.ExchangeBinance:
+		if binanceMarket(utils.GetConfig().Crypto.BinanceKlinesPoint) == models.MarketFutures {
+			return binanceFuturesMaxLimit
+		}
+		return binanceSpotMaxLimit
+	case models.ExchangeBybit:
+		return bybitMaxLimit
+	case models.ExchangeOKX:
+		return okxMaxLimit
+	default:
+		return binanceSpotMaxLimit
+	}
+}
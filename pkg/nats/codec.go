@@ -0,0 +1,519 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"infosir/internal/models"
+
+	"github.com/nats-io/nats.go"
+	"github.com/shopspring/decimal"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Headers describing the payload of a kline message.
+const (
+	// HeaderContentType names the codec of the payload, e.g. "application/msgpack".
+	// Messages without it predate the codec layer and are JSON.
+	HeaderContentType = "Content-Type"
+	// HeaderSchemaVersion is the version of the kline schema the payload follows.
+	HeaderSchemaVersion = "Infosir-Schema-Version"
+)
+
+// Content types of the supported codecs.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// Codec encodes kline envelopes to a message payload and back.
+type Codec interface {
+	// Name is the codec name used in configuration (NATS_CODEC).
+	Name() string
+	// ContentType is the value of the Content-Type header of messages encoded by this codec.
+	ContentType() string
+	// Encode encodes the envelope in the current schema version.
+	Encode(env KlineEnvelope) ([]byte, error)
+	// Decode decodes a payload of the given schema version (see SchemaVersion).
+	Decode(version int, data []byte) (KlineEnvelope, error)
+}
+
+var codecs = []Codec{jsonCodec{}, msgpackCodec{}, protobufCodec{}}
+
+// CodecByName returns the codec with the given configuration name: json, msgpack or protobuf.
+func CodecByName(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+// CodecForHeader returns the codec a message was encoded with, judging by its Content-Type header.
+func CodecForHeader(h nats.Header) (Codec, error) {
+	ct := h.Get(HeaderContentType)
+	if ct == "" {
+		return jsonCodec{}, nil
+	}
+	for _, c := range codecs {
+		if c.ContentType() == ct {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported content type %q", ct)
+}
+
+// NewKlinesMsg returns a message to subject carrying the envelope encoded with the codec,
+// labelled with the content type and schema version headers.
+func NewKlinesMsg(subject string, codec Codec, env KlineEnvelope) (*nats.Msg, error) {
+	data, err := codec.Encode(env)
+	if err != nil {
+		return nil, fmt.Errorf("%s encode klines error: %w", codec.Name(), err)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	msg.Header.Set(HeaderContentType, codec.ContentType())
+	msg.Header.Set(HeaderSchemaVersion, strconv.Itoa(SchemaVersion))
+	return msg, nil
+}
+
+// jsonCodec encodes the envelope as a JSON object. Version 1 is a JSON array of models.Kline,
+// the original wire format.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return "json" }
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Encode(env KlineEnvelope) ([]byte, error) {
+	return json.Marshal(env)
+}
+
+func (jsonCodec) Decode(version int, data []byte) (KlineEnvelope, error) {
+	var env KlineEnvelope
+	switch version {
+	case SchemaV1:
+		err := json.Unmarshal(data, &env.Klines)
+		return env, err
+	case SchemaV2:
+		err := json.Unmarshal(data, &env)
+		return env, err
+	}
+	return env, fmt.Errorf("%w: %d", ErrUnsupportedSchema, version)
+}
+
+// wireKline is the compact kline representation of the binary codecs. Times are unix
+// milliseconds (0 for the zero time) and decimals are their exact string representation.
+// MessagePack encodes it as a map with short keys, so fields can be added (see SchemaVersion).
+type wireKline struct {
+	OpenTime            int64  `msgpack:"t,omitempty"`
+	CloseTime           int64  `msgpack:"ct,omitempty"`
+	IsClosed            bool   `msgpack:"x,omitempty"`
+	Exchange            string `msgpack:"e,omitempty"`
+	Market              string `msgpack:"m,omitempty"`
+	Symbol              string `msgpack:"s,omitempty"`
+	Interval            string `msgpack:"i,omitempty"`
+	Open                string `msgpack:"o,omitempty"`
+	High                string `msgpack:"h,omitempty"`
+	Low                 string `msgpack:"l,omitempty"`
+	Close               string `msgpack:"c,omitempty"`
+	Volume              string `msgpack:"v,omitempty"`
+	QuoteVolume         string `msgpack:"q,omitempty"`
+	Trades              int64  `msgpack:"n,omitempty"`
+	TakerBuyBaseVolume  string `msgpack:"V,omitempty"`
+	TakerBuyQuoteVolume string `msgpack:"Q,omitempty"`
+}
+
+// wireKlinesOf converts klines to their wire representation.
+func wireKlinesOf(klines []models.Kline) []wireKline {
+	wire := make([]wireKline, len(klines))
+	for i, k := range klines {
+		wire[i] = toWire(k)
+	}
+	return wire
+}
+
+// klinesOf converts wire klines back to models.Kline.
+func klinesOf(wire []wireKline) ([]models.Kline, error) {
+	klines := make([]models.Kline, len(wire))
+	for i, w := range wire {
+		k, err := w.kline()
+		if err != nil {
+			return nil, fmt.Errorf("kline %d: %w", i, err)
+		}
+		klines[i] = k
+	}
+	return klines, nil
+}
+
+func toWire(k models.Kline) wireKline {
+	return wireKline{
+		OpenTime:            timeToMs(k.Time),
+		CloseTime:           timeToMs(k.CloseTime),
+		IsClosed:            k.IsClosed,
+		Exchange:            k.Exchange,
+		Market:              k.Market,
+		Symbol:              k.Symbol,
+		Interval:            k.Interval,
+		Open:                k.OpenPrice.String(),
+		High:                k.HighPrice.String(),
+		Low:                 k.LowPrice.String(),
+		Close:               k.ClosePrice.String(),
+		Volume:              k.Volume.String(),
+		QuoteVolume:         k.QuoteVolume.String(),
+		Trades:              k.Trades,
+		TakerBuyBaseVolume:  k.TakerBuyBaseVolume.String(),
+		TakerBuyQuoteVolume: k.TakerBuyQuoteVolume.String(),
+	}
+}
+
+func (w wireKline) kline() (models.Kline, error) {
+	k := models.Kline{
+		Time:      msToTime(w.OpenTime),
+		CloseTime: msToTime(w.CloseTime),
+		IsClosed:  w.IsClosed,
+		Exchange:  w.Exchange,
+		Market:    w.Market,
+		Symbol:    w.Symbol,
+		Interval:  w.Interval,
+		Trades:    w.Trades,
+	}
+
+	for _, f := range []struct {
+		dst *decimal.Decimal
+		src string
+	}{
+		{&k.OpenPrice, w.Open},
+		{&k.HighPrice, w.High},
+		{&k.LowPrice, w.Low},
+		{&k.ClosePrice, w.Close},
+		{&k.Volume, w.Volume},
+		{&k.QuoteVolume, w.QuoteVolume},
+		{&k.TakerBuyBaseVolume, w.TakerBuyBaseVolume},
+		{&k.TakerBuyQuoteVolume, w.TakerBuyQuoteVolume},
+	} {
+		if f.src == "" {
+			continue
+		}
+		d, err := decimal.NewFromString(f.src)
+		if err != nil {
+			return models.Kline{}, err
+		}
+		*f.dst = d
+	}
+	return k, nil
+}
+
+func timeToMs(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func msToTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
+
+// msgpackCodec encodes the envelope as a MessagePack map.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return "msgpack" }
+func (msgpackCodec) ContentType() string { return ContentTypeMsgpack }
+
+// msgpackEnvelope is the MessagePack layout of KlineEnvelope.
+type msgpackEnvelope struct {
+	SchemaVersion int         `msgpack:"v"`
+	Exchange      string      `msgpack:"e,omitempty"`
+	Interval      string      `msgpack:"i,omitempty"`
+	ProducedAtMs  int64       `msgpack:"p,omitempty"`
+	BatchID       string      `msgpack:"b,omitempty"`
+	Klines        []wireKline `msgpack:"k"`
+}
+
+func (msgpackCodec) Encode(env KlineEnvelope) ([]byte, error) {
+	return msgpack.Marshal(msgpackEnvelope{
+		SchemaVersion: SchemaVersion,
+		Exchange:      env.Exchange,
+		Interval:      env.Interval,
+		ProducedAtMs:  timeToMs(env.ProducedAt),
+		BatchID:       env.BatchID,
+		Klines:        wireKlinesOf(env.Klines),
+	})
+}
+
+// Decode accepts schema version 2 only: version 1 predates the binary codecs.
+func (msgpackCodec) Decode(version int, data []byte) (KlineEnvelope, error) {
+	if version != SchemaV2 {
+		return KlineEnvelope{}, fmt.Errorf("%w: %d", ErrUnsupportedSchema, version)
+	}
+
+	var me msgpackEnvelope
+	if err := msgpack.Unmarshal(data, &me); err != nil {
+		return KlineEnvelope{}, err
+	}
+	klines, err := klinesOf(me.Klines)
+	return KlineEnvelope{
+		SchemaVersion: me.SchemaVersion,
+		Exchange:      me.Exchange,
+		Interval:      me.Interval,
+		ProducedAt:    msToTime(me.ProducedAtMs),
+		BatchID:       me.BatchID,
+		Klines:        klines,
+	}, err
+}
+
+// protobufCodec encodes the envelope as the KlineEnvelope message of kline.proto. It is written
+// against protowire directly, so no generated code is needed; field numbers must match kline.proto.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string        { return "protobuf" }
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+// Field numbers of the Kline message in kline.proto.
+const (
+	pbOpenTime protowire.Number = iota + 1
+	pbCloseTime
+	pbIsClosed
+	pbExchange
+	pbMarket
+	pbSymbol
+	pbInterval
+	pbOpen
+	pbHigh
+	pbLow
+	pbClose
+	pbVolume
+	pbQuoteVolume
+	pbTrades
+	pbTakerBuyBaseVolume
+	pbTakerBuyQuoteVolume
+)
+
+// Field numbers of the KlineEnvelope message in kline.proto.
+const (
+	pbEnvSchemaVersion protowire.Number = iota + 1
+	pbEnvExchange
+	pbEnvInterval
+	pbEnvProducedAt
+	pbEnvBatchID
+	pbEnvKlines
+)
+
+func (protobufCodec) Encode(env KlineEnvelope) ([]byte, error) {
+	var out []byte
+	out = appendVarintField(out, pbEnvSchemaVersion, SchemaVersion)
+	out = appendStringField(out, pbEnvExchange, env.Exchange)
+	out = appendStringField(out, pbEnvInterval, env.Interval)
+	out = appendVarintField(out, pbEnvProducedAt, uint64(timeToMs(env.ProducedAt)))
+	out = appendStringField(out, pbEnvBatchID, env.BatchID)
+	return appendProtoKlines(out, pbEnvKlines, env.Klines), nil
+}
+
+// Decode accepts schema version 2 only: version 1 predates the binary codecs.
+func (protobufCodec) Decode(version int, data []byte) (KlineEnvelope, error) {
+	if version != SchemaV2 {
+		return KlineEnvelope{}, fmt.Errorf("%w: %d", ErrUnsupportedSchema, version)
+	}
+
+	var env KlineEnvelope
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return KlineEnvelope{}, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == pbEnvKlines && typ == protowire.BytesType:
+			kb, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return KlineEnvelope{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+
+			w, err := decodeProtoKline(kb)
+			if err == nil {
+				var k models.Kline
+				if k, err = w.kline(); err == nil {
+					env.Klines = append(env.Klines, k)
+				}
+			}
+			if err != nil {
+				return KlineEnvelope{}, fmt.Errorf("kline %d: %w", len(env.Klines), err)
+			}
+
+		case typ == protowire.VarintType &&
+			(num == pbEnvSchemaVersion || num == pbEnvProducedAt):
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return KlineEnvelope{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+			if num == pbEnvSchemaVersion {
+				env.SchemaVersion = int(v)
+			} else {
+				env.ProducedAt = msToTime(int64(v))
+			}
+
+		case typ == protowire.BytesType &&
+			(num == pbEnvExchange || num == pbEnvInterval || num == pbEnvBatchID):
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return KlineEnvelope{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+			switch num {
+			case pbEnvExchange:
+				env.Exchange = v
+			case pbEnvInterval:
+				env.Interval = v
+			default:
+				env.BatchID = v
+			}
+
+		default: // unknown fields are skipped, see SchemaVersion
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return KlineEnvelope{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return env, nil
+}
+
+// appendProtoKlines appends each kline as an embedded Kline message in field num.
+func appendProtoKlines(out []byte, num protowire.Number, klines []models.Kline) []byte {
+	var kb []byte
+	for _, k := range klines {
+		w := toWire(k)
+		kb = kb[:0]
+		kb = appendVarintField(kb, pbOpenTime, uint64(w.OpenTime))
+		kb = appendVarintField(kb, pbCloseTime, uint64(w.CloseTime))
+		if w.IsClosed {
+			kb = appendVarintField(kb, pbIsClosed, 1)
+		}
+		kb = appendStringField(kb, pbExchange, w.Exchange)
+		kb = appendStringField(kb, pbMarket, w.Market)
+		kb = appendStringField(kb, pbSymbol, w.Symbol)
+		kb = appendStringField(kb, pbInterval, w.Interval)
+		kb = appendStringField(kb, pbOpen, w.Open)
+		kb = appendStringField(kb, pbHigh, w.High)
+		kb = appendStringField(kb, pbLow, w.Low)
+		kb = appendStringField(kb, pbClose, w.Close)
+		kb = appendStringField(kb, pbVolume, w.Volume)
+		kb = appendStringField(kb, pbQuoteVolume, w.QuoteVolume)
+		kb = appendVarintField(kb, pbTrades, uint64(w.Trades))
+		kb = appendStringField(kb, pbTakerBuyBaseVolume, w.TakerBuyBaseVolume)
+		kb = appendStringField(kb, pbTakerBuyQuoteVolume, w.TakerBuyQuoteVolume)
+
+		out = protowire.AppendTag(out, num, protowire.BytesType)
+		out = protowire.AppendBytes(out, kb)
+	}
+	return out
+}
+
+// decodeProtoKline parses one Kline message. Unknown fields are skipped, so newer producers
+// may add fields without breaking older consumers.
+func decodeProtoKline(b []byte) (wireKline, error) {
+	var w wireKline
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return w, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case typ == protowire.VarintType && (num == pbOpenTime || num == pbCloseTime || num == pbIsClosed || num == pbTrades):
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return w, protowire.ParseError(n)
+			}
+			b = b[n:]
+			switch num {
+			case pbOpenTime:
+				w.OpenTime = int64(v)
+			case pbCloseTime:
+				w.CloseTime = int64(v)
+			case pbIsClosed:
+				w.IsClosed = v != 0
+			case pbTrades:
+				w.Trades = int64(v)
+			}
+
+		case typ == protowire.BytesType && num >= pbExchange && num <= pbTakerBuyQuoteVolume && num != pbTrades:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return w, protowire.ParseError(n)
+			}
+			b = b[n:]
+			*w.stringField(num) = v
+
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return w, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return w, nil
+}
+
+// stringField returns the wireKline field of the given string field number.
+func (w *wireKline) stringField(num protowire.Number) *string {
+	switch num {
+	case pbExchange:
+		return &w.Exchange
+	case pbMarket:
+		return &w.Market
+	case pbSymbol:
+		return &w.Symbol
+	case pbInterval:
+		return &w.Interval
+	case pbOpen:
+		return &w.Open
+	case pbHigh:
+		return &w.High
+	case pbLow:
+		return &w.Low
+	case pbClose:
+		return &w.Close
+	case pbVolume:
+		return &w.Volume
+	case pbQuoteVolume:
+		return &w.QuoteVolume
+	case pbTakerBuyBaseVolume:
+		return &w.TakerBuyBaseVolume
+	default:
+		return &w.TakerBuyQuoteVolume
+	}
+}
+
+// appendVarintField appends a varint field, omitting zero values like proto3 does.
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendStringField appends a string field, omitting empty values like proto3 does.
+func appendStringField(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
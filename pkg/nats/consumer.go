@@ -2,8 +2,9 @@ package nats
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"infosir/internal/db/repository"
 	"infosir/internal/models"
@@ -13,74 +14,264 @@ import (
 	"go.uber.org/zap"
 )
 
-// StartJetStreamConsumer sets up a durable consumer on the configured stream/subject
-// and processes messages by deserializing klines, then storing them in DB.
+// StartJetStreamConsumer creates or reconciles the durable pull consumer (see DesiredConsumerConfig)
+// and processes messages in batches: it fetches up to JETSTREAM_FETCH_BATCH messages (waiting at most
+// JETSTREAM_FETCH_MAX_WAIT), merges and deduplicates their klines, stores them in one transaction
+// and only then acks the whole batch. JETSTREAM_MAX_ACK_PENDING bounds the unacknowledged messages
+// in flight.
 func StartJetStreamConsumer(
 	ctx context.Context,
 	js nats.JetStreamContext,
 	klineRepo *repository.KlineRepository,
 ) error {
-	subject := utils.GetConfig().NATS.Subject
-	durableName := utils.GetConfig().NATS.ConsumerName
+	cfg := utils.GetConfig().NATS
+	policy := NewRetryPolicy()
+	filter := ConsumerFilterSubject()
 
-	// We create a pull subscription or push subscription? Let's suppose push:
-	sub, err := js.Subscribe(subject, func(msg *nats.Msg) {
-		err := handleKlinesMsg(ctx, msg, klineRepo)
-		if err != nil {
-			utils.Logger.Error("handleKlinesMsg error", zap.Error(err))
-			// we can either NAK or let the message fail. For now let's Ack anyway.
-		}
-		_ = msg.Ack() // ack to JetStream
-	}, nats.Durable(durableName), nats.ManualAck())
+	if err := ensureConsumer(js, cfg.StreamName, DesiredConsumerConfig()); err != nil {
+		return err
+	}
+
+	sub, err := js.PullSubscribe(filter, cfg.ConsumerName,
+		nats.Bind(cfg.StreamName, cfg.ConsumerName),
+		nats.ManualAck())
 	if err != nil {
-		return fmt.Errorf("js.Subscribe error: %w", err)
+		return fmt.Errorf("js.PullSubscribe error: %w", err)
 	}
 
 	utils.Logger.Info("JetStream consumer started",
-		zap.String("subject", subject),
-		zap.String("durableName", durableName),
-		zap.String("queue", ""), // if we used a queue group, specify
+		zap.String("filterSubject", filter),
+		zap.String("durableName", cfg.ConsumerName),
+		zap.Int("batchSize", cfg.FetchBatch),
+		zap.Duration("maxWait", cfg.FetchMaxWait),
+		zap.Int("maxAckPending", cfg.MaxAckPending),
 	)
 
-	// Wait in a goroutine for context cancellation, unsub when done
+	// The subscription is not unsubscribed on shutdown: that would delete the durable consumer.
+	// Unacked messages are redelivered to the next process.
 	go func() {
-		<-ctx.Done()
-		_ = sub.Unsubscribe()
-		utils.Logger.Info("Unsubscribed from JetStream consumer", zap.String("subject", subject))
+		for ctx.Err() == nil {
+			msgs, err := sub.Fetch(cfg.FetchBatch, nats.MaxWait(cfg.FetchMaxWait))
+			if errors.Is(err, nats.ErrTimeout) {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					utils.Logger.Error("Failed to fetch from JetStream", zap.Error(err))
+					time.Sleep(cfg.FetchMaxWait)
+				}
+				continue
+			}
+			processBatch(ctx, js, msgs, klineRepo, policy)
+		}
+		utils.Logger.Info("Stopped JetStream consumer", zap.String("filterSubject", filter))
 	}()
 
 	return nil
 }
 
-// handleKlinesMsg handles a single NATS message, deserializing klines and writing them to DB.
-func handleKlinesMsg(
+// KlineTxStore stores klines atomically: all of them or, on error, none.
+type KlineTxStore interface {
+	StoreKlinesTx(ctx context.Context, klines []models.Kline) error
+}
+
+// processBatch decodes a batch of messages, stores their klines (see StoreBatches) and settles
+// every message with its own outcome. Undecodable messages are settled on their own so that
+// they can't hold back the rest of the batch.
+func processBatch(
 	ctx context.Context,
-	msg *nats.Msg,
-	klineRepo *repository.KlineRepository,
-) error {
-	klines, err := decodeKlines(msg.Data)
-	if err != nil {
-		return fmt.Errorf("decodeKlines: %w", err)
+	js nats.JetStreamContext,
+	msgs []*nats.Msg,
+	store KlineTxStore,
+	policy RetryPolicy,
+) {
+	decoded := make([]*nats.Msg, 0, len(msgs))
+	batches := make([][]models.Kline, 0, len(msgs))
+	for _, msg := range msgs {
+		klines, err := decodeKlines(msg.Header, msg.Data)
+		if err != nil {
+			settleMsg(js, msg, policy, fmt.Errorf("%w: decodeKlines: %v", errUndecodable, err))
+			continue
+		}
+		decoded = append(decoded, msg)
+		batches = append(batches, klines)
+	}
+	if len(decoded) == 0 {
+		return
 	}
 
+	errs := StoreBatches(ctx, store, batches)
+
+	failed := 0
+	for i, msg := range decoded {
+		if errs[i] != nil {
+			failed++
+		}
+		settleMsg(js, msg, policy, errs[i])
+	}
+
+	utils.Logger.Debug("Stored klines from message batch",
+		zap.Int("messages", len(decoded)),
+		zap.Int("failed", failed))
+}
+
+// StoreBatches stores the klines of a batch of messages, given per message in delivery order, and
+// returns the outcome of every message. The merged klines of the whole batch are stored in one
+// transaction. If that fails, the batch is split in halves which are stored on their own, down to
+// single messages, so that one kline the database rejects fails only the message carrying it.
+// Storing halves separately is safe: the upsert never replaces a closed candle with an open one.
+func StoreBatches(ctx context.Context, store KlineTxStore, batches [][]models.Kline) []error {
+	errs := make([]error, len(batches))
+	storeBatches(ctx, store, batches, errs)
+	return errs
+}
+
+// storeBatches stores batches and records the outcome of every message in errs.
+func storeBatches(ctx context.Context, store KlineTxStore, batches [][]models.Kline, errs []error) {
+	klines := storedIntervalOnly(MergeKlines(batches))
 	if len(klines) == 0 {
-		utils.Logger.Debug("Received empty klines array, ignoring.")
-		return nil
+		return
 	}
 
-	if err := klineRepo.BatchInsertKlines(ctx, klines); err != nil {
-		return fmt.Errorf("BatchInsertKlines: %w", err)
+	err := store.StoreKlinesTx(ctx, klines)
+	if err == nil {
+		return
+	}
+	if len(batches) == 1 || ctx.Err() != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("StoreKlinesTx: %w", err)
+		}
+		return
 	}
 
-	utils.Logger.Debug("Successfully inserted klines from message",
-		zap.Int("count", len(klines)))
+	half := len(batches) / 2
+	storeBatches(ctx, store, batches[:half], errs[:half])
+	storeBatches(ctx, store, batches[half:], errs[half:])
+}
 
-	return nil
+// MergeKlines flattens the klines of several messages, given in delivery order, into one slice
+// with a single kline per (exchange, market, symbol, interval, open time). A closed candle beats
+// an open one; otherwise the later delivery wins. The result keeps first-seen order.
+func MergeKlines(batches [][]models.Kline) []models.Kline {
+	type key struct {
+		inst     models.Instrument
+		interval string
+		openMs   int64
+	}
+
+	index := make(map[key]int)
+	var merged []models.Kline
+	for _, klines := range batches {
+		for _, k := range klines {
+			id := key{inst: k.Instrument(), interval: k.Interval, openMs: k.Time.UnixMilli()}
+			i, seen := index[id]
+			if !seen {
+				index[id] = len(merged)
+				merged = append(merged, k)
+				continue
+			}
+			if k.IsClosed || !merged[i].IsClosed {
+				merged[i] = k
+			}
+		}
+	}
+	return merged
+}
+
+// settleMsg acknowledges a processed message. Failed messages are redelivered with exponential
+// backoff; undecodable ones, and those that failed MaxDeliver times, are republished to the
+// dead-letter stream and terminated. If even the dead-letter publish fails, the message is NAKed
+// so that nothing is lost.
+func settleMsg(js nats.JetStreamContext, msg *nats.Msg, policy RetryPolicy, err error) {
+	if err == nil {
+		_ = msg.Ack() // ack to JetStream
+		return
+	}
+
+	var delivered uint64 = 1
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		delivered = meta.NumDelivered
+	}
+
+	reason := ""
+	switch {
+	case errors.Is(err, errUndecodable):
+		reason = DLQReasonUndecodable
+	case policy.Exhausted(delivered):
+		reason = DLQReasonMaxDeliveries
+	}
+
+	if reason == "" {
+		delay := policy.Delay(delivered)
+		utils.Logger.Warn("handleKlinesMsg error; will redeliver",
+			zap.Uint64("delivered", delivered),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+		_ = msg.NakWithDelay(delay)
+		return
+	}
+
+	dlqSubject := utils.GetConfig().NATS.DLQSubject
+	if _, pubErr := js.PublishMsg(DeadLetterMsg(msg, dlqSubject, reason, err)); pubErr != nil {
+		utils.Logger.Error("Failed to dead-letter message; will redeliver",
+			zap.String("reason", reason),
+			zap.Error(err),
+			zap.NamedError("publishError", pubErr))
+		_ = msg.NakWithDelay(policy.MaxDelay)
+		return
+	}
+
+	utils.Logger.Error("Moved message to the dead-letter stream",
+		zap.String("reason", reason),
+		zap.String("dlqSubject", dlqSubject),
+		zap.Uint64("delivered", delivered),
+		zap.Error(err))
+	_ = msg.Term()
 }
 
-// decodeKlines attempts to unmarshal JSON data into a slice of model.Kline.
-func decodeKlines(data []byte) ([]models.Kline, error) {
-	var klines []models.Kline
-	err := json.Unmarshal(data, &klines)
-	return klines, err
+// storedIntervalOnly drops klines of other intervals than the stored one (KlineInterval).
+// Those are published for downstream consumers; storage aggregates them from the stored interval.
+func storedIntervalOnly(klines []models.Kline) []models.Kline {
+	stored := utils.GetConfig().Crypto.KlineInterval
+
+	kept := klines[:0]
+	for _, k := range klines {
+		if k.Interval == stored {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+// decodeKlines decodes a message payload of any supported schema version (see DecodeEnvelope)
+// into a slice of model.Kline. Messages published before the exchange/market dimension existed carry neither field;
+// those klines are Binance futures, matching the back-fill of migration 0003. Likewise,
+// messages without a close time predate open/closed tracking and are treated as closed
+// candles of the configured interval. Messages without an interval predate multi-interval
+// scheduling and carry klines of the configured interval.
+func decodeKlines(header nats.Header, data []byte) ([]models.Kline, error) {
+	env, err := DecodeEnvelope(header, data)
+	if err != nil {
+		return nil, err
+	}
+	klines := env.Klines
+
+	legacyInterval := models.Interval(utils.GetConfig().Crypto.KlineInterval)
+
+	for i := range klines {
+		if klines[i].Exchange == "" {
+			klines[i].Exchange = models.ExchangeBinance
+		}
+		if klines[i].Market == "" {
+			klines[i].Market = models.MarketFutures
+		}
+		if klines[i].Interval == "" {
+			klines[i].Interval = legacyInterval.String()
+		}
+		if klines[i].CloseTime.IsZero() {
+			klines[i].CloseTime = models.CloseTimeFor(klines[i].Time, legacyInterval.Duration())
+			klines[i].IsClosed = true
+		}
+	}
+	return klines, nil
 }
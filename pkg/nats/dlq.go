@@ -0,0 +1,182 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// Headers set on every dead-lettered message. They share dlqHeaderPrefix and are stripped on replay.
+const (
+	dlqHeaderPrefix = "Infosir-Dlq-"
+
+	HeaderDLQReason          = "Infosir-Dlq-Reason"
+	HeaderDLQError           = "Infosir-Dlq-Error"
+	HeaderDLQOriginalSubject = "Infosir-Dlq-Original-Subject"
+	HeaderDLQOriginalStream  = "Infosir-Dlq-Original-Stream"
+	HeaderDLQOriginalSeq     = "Infosir-Dlq-Original-Sequence"
+	HeaderDLQDeliveries      = "Infosir-Dlq-Deliveries"
+	HeaderDLQFailedAt        = "Infosir-Dlq-Failed-At"
+)
+
+// Reasons a message ends up in the dead-letter stream.
+const (
+	// DLQReasonUndecodable marks payloads that can never be processed.
+	DLQReasonUndecodable = "undecodable"
+	// DLQReasonMaxDeliveries marks messages that kept failing until MaxDeliver was reached.
+	DLQReasonMaxDeliveries = "max_deliveries"
+)
+
+// errUndecodable wraps decode errors: such messages are dead-lettered at once instead of retried.
+var errUndecodable = errors.New("undecodable message")
+
+// RetryPolicy decides how long a failed message waits before redelivery and when to give up.
+type RetryPolicy struct {
+	// MaxDeliver is the number of deliveries after which a failing message is dead-lettered.
+	MaxDeliver int
+	// BaseDelay is the redelivery delay after the first failure; it doubles with every delivery.
+	BaseDelay time.Duration
+	// MaxDelay caps the redelivery delay.
+	MaxDelay time.Duration
+}
+
+// NewRetryPolicy returns the retry policy configured in NATSConfig.
+func NewRetryPolicy() RetryPolicy {
+	cfg := utils.GetConfig().NATS
+	return RetryPolicy{MaxDeliver: cfg.MaxDeliver, BaseDelay: cfg.NakDelay, MaxDelay: cfg.NakMaxDelay}
+}
+
+// Delay returns the NAK delay for a message that failed on its 'delivered'-th delivery (1-based).
+func (p RetryPolicy) Delay(delivered uint64) time.Duration {
+	delay := p.BaseDelay
+	for i := uint64(1); i < delivered && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Exhausted reports whether a message that failed on its 'delivered'-th delivery must not be retried.
+func (p RetryPolicy) Exhausted(delivered uint64) bool {
+	return delivered >= uint64(p.MaxDeliver)
+}
+
+// DeadLetterMsg builds the dead-letter copy of a JetStream message: same payload and headers,
+// plus headers describing why and where it failed.
+func DeadLetterMsg(msg *nats.Msg, dlqSubject, reason string, cause error) *nats.Msg {
+	dead := nats.NewMsg(dlqSubject)
+	dead.Data = msg.Data
+	for key, values := range msg.Header {
+		for _, v := range values {
+			dead.Header.Add(key, v)
+		}
+	}
+
+	dead.Header.Set(HeaderDLQReason, reason)
+	if cause != nil {
+		dead.Header.Set(HeaderDLQError, cause.Error())
+	}
+	dead.Header.Set(HeaderDLQOriginalSubject, msg.Subject)
+	dead.Header.Set(HeaderDLQFailedAt, time.Now().UTC().Format(time.RFC3339Nano))
+	if meta, err := msg.Metadata(); err == nil {
+		dead.Header.Set(HeaderDLQOriginalStream, meta.Stream)
+		dead.Header.Set(HeaderDLQOriginalSeq, strconv.FormatUint(meta.Sequence.Stream, 10))
+		dead.Header.Set(HeaderDLQDeliveries, strconv.FormatUint(meta.NumDelivered, 10))
+	}
+	return dead
+}
+
+// ReplayDLQ republishes dead-lettered messages to the subject they originally failed on, at most
+// 'limit' of them (0 means all). Every replayed message is acked and thereby removed from the
+// work-queue DLQ stream. With dryRun, messages are only logged and stay in the DLQ.
+// It returns the number of messages replayed (or that would have been).
+func ReplayDLQ(ctx context.Context, js nats.JetStreamContext, limit int, dryRun bool) (int, error) {
+	cfg := utils.GetConfig().NATS
+
+	sub, err := js.PullSubscribe(cfg.DLQSubject, "", nats.BindStream(cfg.DLQStreamName))
+	if err != nil {
+		return 0, fmt.Errorf("subscribe to DLQ: %w", err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	replayed := 0
+	for limit == 0 || replayed < limit {
+		batch := 100
+		if limit > 0 && limit-replayed < batch {
+			batch = limit - replayed
+		}
+
+		msgs, err := sub.Fetch(batch, nats.MaxWait(2*time.Second), nats.Context(ctx))
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			break // the DLQ is drained
+		}
+		if err != nil {
+			return replayed, fmt.Errorf("fetch from DLQ: %w", err)
+		}
+
+		for _, msg := range msgs {
+			subject := msg.Header.Get(HeaderDLQOriginalSubject)
+			if subject == "" {
+				subject = replaySubject(cfg.Subject, msg.Header, msg.Data)
+			}
+
+			utils.Logger.Info("Replaying dead-lettered message",
+				zap.String("subject", subject),
+				zap.String("reason", msg.Header.Get(HeaderDLQReason)),
+				zap.String("error", msg.Header.Get(HeaderDLQError)),
+				zap.String("originalSeq", msg.Header.Get(HeaderDLQOriginalSeq)),
+				zap.Bool("dryRun", dryRun))
+
+			if dryRun {
+				// Leave it in the DLQ, but don't hand it out again during this run.
+				_ = msg.InProgress()
+				replayed++
+				continue
+			}
+
+			replay := nats.NewMsg(subject)
+			replay.Data = msg.Data
+			for key, values := range msg.Header {
+				// The original Nats-Msg-Id is still within the duplicate window of a recent message,
+				// and the stream would drop the replay as a duplicate.
+				if strings.HasPrefix(key, dlqHeaderPrefix) || key == nats.MsgIdHdr {
+					continue
+				}
+				for _, v := range values {
+					replay.Header.Add(key, v)
+				}
+			}
+			if _, err := js.PublishMsg(replay, nats.Context(ctx)); err != nil {
+				_ = msg.Nak()
+				return replayed, fmt.Errorf("republish to %s: %w", subject, err)
+			}
+			if err := msg.AckSync(nats.Context(ctx)); err != nil {
+				return replayed, fmt.Errorf("ack DLQ message: %w", err)
+			}
+			replayed++
+		}
+	}
+
+	return replayed, nil
+}
+
+// replaySubject derives the kline subject of a dead-lettered message without the original subject
+// header from its payload. Undecodable payloads fall back to "<prefix>._._._".
+func replaySubject(prefix string, header nats.Header, data []byte) string {
+	klines, err := decodeKlines(header, data)
+	if err != nil || len(klines) == 0 {
+		return KlineSubject(prefix, models.Kline{})
+	}
+	return KlineSubject(prefix, klines[0])
+}
@@ -0,0 +1,126 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"infosir/internal/models"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+// Kline message schema versions. The version travels in the Infosir-Schema-Version header and,
+// from version 2 on, in the envelope itself.
+//
+// Compatibility rules:
+//   - Adding a field to KlineEnvelope or to the kline wire format is backwards compatible and keeps
+//     the version: every codec ignores fields it doesn't know, and missing fields decode as zero.
+//   - Removing, renaming, renumbering or retyping a field is not: it needs a new version, and the
+//     decoders of all older versions stay in place so that stored and dead-lettered messages remain
+//     readable.
+//   - A consumer rejects versions newer than SchemaVersion instead of guessing; such messages go to
+//     the dead-letter stream and can be replayed once the consumer is upgraded.
+const (
+	// SchemaV1 is a bare JSON array of klines, from before the binary codecs existed. Messages
+	// without a schema header are version 1.
+	SchemaV1 = 1
+	// SchemaV2 is the KlineEnvelope.
+	SchemaV2 = 2
+
+	// SchemaVersion is the version written by this producer.
+	SchemaVersion = SchemaV2
+)
+
+// ErrUnsupportedSchema is returned for messages of an unknown schema version.
+var ErrUnsupportedSchema = errors.New("unsupported kline schema version")
+
+// KlineEnvelope is the payload of a kline message: a batch of klines plus where and when it was
+// produced. Klines without an exchange or interval of their own belong to the envelope's.
+type KlineEnvelope struct {
+	// SchemaVersion is the version of the schema the envelope was encoded with.
+	SchemaVersion int `json:"schema_version"`
+	// Exchange is the exchange the klines come from, e.g. "binance".
+	Exchange string `json:"exchange"`
+	// Interval is the candle interval of the klines, e.g. "1m".
+	Interval string `json:"interval"`
+	// ProducedAt is when the producer built the batch.
+	ProducedAt time.Time `json:"produced_at"`
+	// BatchID identifies the publish call the message belongs to; a batch may span several messages.
+	BatchID string `json:"batch_id"`
+	// Klines holds the candles.
+	Klines []models.Kline `json:"klines"`
+}
+
+// NewKlineEnvelope wraps klines of one exchange and interval in an envelope of the current schema
+// version, produced now, with the given batch id (a new one if empty).
+func NewKlineEnvelope(batchID string, klines []models.Kline) KlineEnvelope {
+	if batchID == "" {
+		batchID = nuid.Next()
+	}
+	env := KlineEnvelope{
+		SchemaVersion: SchemaVersion,
+		ProducedAt:    time.Now().UTC(),
+		BatchID:       batchID,
+		Klines:        klines,
+	}
+	if len(klines) > 0 {
+		env.Exchange = klines[0].Exchange
+		env.Interval = klines[0].Interval
+	}
+	return env
+}
+
+// SchemaVersionOf returns the schema version a message declares in its header.
+func SchemaVersionOf(h nats.Header) (int, error) {
+	v := h.Get(HeaderSchemaVersion)
+	if v == "" {
+		return SchemaV1, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedSchema, v)
+	}
+	return version, nil
+}
+
+// DecodeEnvelope decodes a kline message of any supported schema version into an envelope, using
+// the codec named by its Content-Type header. Version 1 payloads yield an envelope with
+// SchemaVersion 1 whose exchange and interval are taken from the first kline.
+func DecodeEnvelope(h nats.Header, data []byte) (KlineEnvelope, error) {
+	codec, err := CodecForHeader(h)
+	if err != nil {
+		return KlineEnvelope{}, err
+	}
+	version, err := SchemaVersionOf(h)
+	if err != nil {
+		return KlineEnvelope{}, err
+	}
+	if version < SchemaV1 || version > SchemaVersion {
+		return KlineEnvelope{}, fmt.Errorf("%w: %d", ErrUnsupportedSchema, version)
+	}
+
+	env, err := codec.Decode(version, data)
+	if err != nil {
+		return KlineEnvelope{}, err
+	}
+
+	if version == SchemaV1 {
+		env.SchemaVersion = SchemaV1
+		if len(env.Klines) > 0 {
+			env.Exchange = env.Klines[0].Exchange
+			env.Interval = env.Klines[0].Interval
+		}
+	}
+	for i := range env.Klines {
+		if env.Klines[i].Exchange == "" {
+			env.Klines[i].Exchange = env.Exchange
+		}
+		if env.Klines[i].Interval == "" {
+			env.Klines[i].Interval = env.Interval
+		}
+	}
+	return env, nil
+}
@@ -2,13 +2,15 @@ package nats
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"sync/atomic"
 
 	"infosir/internal/models"
 	"infosir/internal/utils"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
 	"go.uber.org/zap"
 )
 
@@ -18,38 +20,113 @@ type natsJetStreamClient struct {
 	js     nats.JetStreamContext
 	stream string
 	subj   string
+	codec  Codec
+
+	published  atomic.Uint64
+	duplicates atomic.Uint64
 }
 
 // NewNatsJetStreamClient constructs a new natsJetStreamClient using the provided js context.
-func NewNatsJetStreamClient(js nats.JetStreamContext) *natsJetStreamClient {
+// Messages are encoded with the codec named by NATS_CODEC.
+func NewNatsJetStreamClient(js nats.JetStreamContext) (*natsJetStreamClient, error) {
+	codec, err := CodecByName(utils.GetConfig().NATS.Codec)
+	if err != nil {
+		return nil, err
+	}
+
 	return &natsJetStreamClient{
 		js:     js,
 		stream: utils.GetConfig().NATS.StreamName,
 		subj:   utils.GetConfig().NATS.Subject,
-	}
+		codec:  codec,
+	}, nil
 }
 
-// PublishKlines publishes the given slice of Klines as JSON to the configured subject.
-func (c *natsJetStreamClient) PublishKlines(ctx context.Context, klines []models.Kline) error {
+// PublishKlines publishes each of the given Klines as its own message to its subject (see
+// KlineSubject), in a KlineEnvelope encoded with the client's codec; the envelopes of one call
+// share a batch id. It returns the combined stream acknowledgement. Every message carries a Nats-Msg-Id derived from
+// the kline (see KlineMsgID), so klines re-published within the stream's duplicate window, e.g.
+// by overlapping scheduler fetches, are dropped by the stream and counted as duplicates.
+func (c *natsJetStreamClient) PublishKlines(ctx context.Context, klines []models.Kline) (models.PublishAck, error) {
 	if len(klines) == 0 {
-		return nil
+		return models.PublishAck{}, nil
 	}
 
-	data, err := json.Marshal(klines)
-	if err != nil {
-		return fmt.Errorf("json.Marshal klines error: %w", err)
+	batchID := nuid.Next()
+	futures := make([]nats.PubAckFuture, 0, len(klines))
+	for _, k := range klines {
+		msg, err := NewKlinesMsg(KlineSubject(c.subj, k), c.codec, NewKlineEnvelope(batchID, []models.Kline{k}))
+		if err != nil {
+			return models.PublishAck{}, err
+		}
+
+		f, err := c.js.PublishMsgAsync(msg, nats.MsgId(KlineMsgID(k)))
+		if err != nil {
+			return models.PublishAck{}, fmt.Errorf("js.PublishAsync error: %w", err)
+		}
+		futures = append(futures, f)
 	}
 
-	// Publish via JetStream
-	ack, err := c.js.Publish(c.subj, data, nats.Context(ctx))
-	if err != nil {
-		return fmt.Errorf("js.Publish error: %w", err)
+	var result models.PublishAck
+	for _, f := range futures {
+		select {
+		case ack := <-f.Ok():
+			result.Stream = ack.Stream
+			if ack.Duplicate {
+				result.Duplicates++
+				continue
+			}
+			result.Published++
+			result.Sequence = ack.Sequence
+		case err := <-f.Err():
+			c.count(result)
+			return result, fmt.Errorf("js.Publish error: %w", err)
+		case <-ctx.Done():
+			c.count(result)
+			return result, ctx.Err()
+		}
 	}
+	c.count(result)
 
 	utils.Logger.Debug("Published klines to JetStream",
-		zap.String("subject", c.subj),
+		zap.String("subject", KlineSubject(c.subj, klines[0])),
 		zap.Int("count", len(klines)),
+		zap.String("batchID", batchID),
 		zap.String("stream", c.stream),
-		zap.String("ackStream", ack.Stream))
-	return nil
+		zap.String("ackStream", result.Stream),
+		zap.Uint64("seq", result.Sequence),
+		zap.Int("duplicates", result.Duplicates))
+	return result, nil
+}
+
+// Stats returns the numbers of stored and deduplicated messages published since startup.
+func (c *natsJetStreamClient) Stats() models.PublishStats {
+	return models.PublishStats{
+		Published:  c.published.Load(),
+		Duplicates: c.duplicates.Load(),
+	}
+}
+
+// count adds the outcome of one PublishKlines call to the totals reported by Stats.
+func (c *natsJetStreamClient) count(ack models.PublishAck) {
+	c.published.Add(uint64(ack.Published))
+	c.duplicates.Add(uint64(ack.Duplicates))
+}
+
+// KlineMsgID returns the deterministic Nats-Msg-Id of a kline message:
+// "<exchange>.<market>.<symbol>.<interval>.<open time in ms>". An in-progress candle changes until
+// it closes, so its ID additionally carries a hash of its prices and volumes: re-publishing the
+// same snapshot is deduplicated, while updates and the final closed candle still get through.
+func KlineMsgID(k models.Kline) string {
+	id := fmt.Sprintf("%s.%s.%s.%s.%d", k.Exchange, k.Market, k.Symbol, k.Interval, k.Time.UnixMilli())
+	if k.IsClosed {
+		return id
+	}
+
+	h := fnv.New64a()
+	for _, v := range []fmt.Stringer{k.OpenPrice, k.HighPrice, k.LowPrice, k.ClosePrice, k.Volume, k.QuoteVolume} {
+		_, _ = h.Write([]byte(v.String()))
+		_, _ = h.Write([]byte{'|'})
+	}
+	return fmt.Sprintf("%s.open.%x", id, h.Sum64())
 }
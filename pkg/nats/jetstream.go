@@ -9,12 +9,10 @@ import (
 	"go.uber.org/zap"
 )
 
-// InitNATSJetStream connects to the NATS server, ensures the stream is created, and returns
-// the raw NATS conn plus a JetStream context.
+// InitNATSJetStream connects to the NATS server, ensures the stream exists with the configured
+// settings (see ensureStream), and returns the raw NATS conn plus a JetStream context.
 func InitNATSJetStream() (*nats.Conn, nats.JetStreamContext, error) {
 	url := utils.GetConfig().NATS.URL
-	streamName := utils.GetConfig().NATS.StreamName
-	subject := utils.GetConfig().NATS.Subject
 
 	nc, err := nats.Connect(url)
 	if err != nil {
@@ -26,17 +24,23 @@ func InitNATSJetStream() (*nats.Conn, nats.JetStreamContext, error) {
 		return nil, nil, fmt.Errorf("nc.JetStream error: %w", err)
 	}
 
-	// ensure the stream is present
-	if _, err := js.StreamInfo(streamName); err != nil {
-		// maybe it doesn't exist yet, attempt to create
+	// ensure the stream is present and matches the configuration; incompatible changes fail startup
+	if err := ensureStream(js, DesiredStreamConfig()); err != nil {
+		return nil, nil, err
+	}
+
+	// ensure the dead-letter stream is present; it is a work queue, so replayed messages are removed
+	dlqStream := utils.GetConfig().NATS.DLQStreamName
+	if _, err := js.StreamInfo(dlqStream); err != nil {
 		_, errCreate := js.AddStream(&nats.StreamConfig{
-			Name:     streamName,
-			Subjects: []string{subject},
+			Name:      dlqStream,
+			Subjects:  []string{utils.GetConfig().NATS.DLQSubject},
+			Retention: nats.WorkQueuePolicy,
 		})
 		if errCreate != nil {
-			return nil, nil, fmt.Errorf("AddStream error: %w", errCreate)
+			return nil, nil, fmt.Errorf("AddStream (DLQ) error: %w", errCreate)
 		}
-		utils.Logger.Info("Created new JetStream stream", zap.String("stream", streamName))
+		utils.Logger.Info("Created new JetStream dead-letter stream", zap.String("stream", dlqStream))
 	}
 
 	return nc, js, nil
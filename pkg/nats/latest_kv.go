@@ -0,0 +1,211 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// ErrNoLatestKline is returned when the bucket holds no candle for the requested series.
+var ErrNoLatestKline = errors.New("no latest kline")
+
+// maxPutAttempts bounds the compare-and-set retries of one key when writers race.
+const maxPutAttempts = 3
+
+// LatestKlineStore keeps the most recent candle of every series in a JetStream Key-Value bucket,
+// keyed "<exchange>.<symbol>.<interval>" (see LatestKlineKey) with the JSON kline as value. The
+// bucket is the interface for other services: they read it or watch it, e.g.
+// "nats kv watch infosir_latest_klines 'binance.*.1m'", to get every update pushed. Keys carry no
+// market: an exchange is expected to serve each symbol from one market only.
+type LatestKlineStore struct {
+	kv nats.KeyValue
+}
+
+// NewLatestKlineStore binds to the bucket named by NATS_KV_LATEST_BUCKET, creating it if needed.
+// The bucket keeps one revision per key, as only the current candle matters.
+func NewLatestKlineStore(js nats.JetStreamContext) (*LatestKlineStore, error) {
+	bucket := utils.GetConfig().NATS.LatestBucket
+
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Latest kline per exchange.symbol.interval",
+			History:     1,
+		})
+		if err == nil {
+			utils.Logger.Info("Created JetStream KV bucket", zap.String("bucket", bucket))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key-value bucket %s: %w", bucket, err)
+	}
+
+	return &LatestKlineStore{kv: kv}, nil
+}
+
+// LatestKlineKey returns the bucket key of a series. Every part is a single key token; empty parts
+// become "_", and wildcards are allowed only via LatestKlineFilter.
+func LatestKlineKey(exchange, symbol, interval string) string {
+	return strings.Join([]string{subjectToken(exchange), subjectToken(symbol), subjectToken(interval)}, ".")
+}
+
+// LatestKlineFilter returns a key filter for Watch; empty parts match any value.
+func LatestKlineFilter(exchange, symbol, interval string) string {
+	parts := []string{exchange, symbol, interval}
+	for i, p := range parts {
+		if p == "" {
+			parts[i] = "*"
+		} else {
+			parts[i] = subjectToken(p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// PutLatest records the newest of the given klines for each series. A stored candle is only
+// replaced by one that opens later, or by the same candle in a newer state, so re-published or
+// historical klines never roll the bucket back.
+func (s *LatestKlineStore) PutLatest(ctx context.Context, klines []models.Kline) error {
+	var errs []error
+	for _, k := range NewestPerSeries(klines) {
+		if err := s.put(ctx, k); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", LatestKlineKey(k.Exchange, k.Symbol, k.Interval), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// put stores k unless the bucket already holds a newer candle, using the revision for
+// compare-and-set so that concurrent writers can't overwrite a newer candle either.
+func (s *LatestKlineStore) put(ctx context.Context, k models.Kline) error {
+	key := LatestKlineKey(k.Exchange, k.Symbol, k.Interval)
+	value, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt < maxPutAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		entry, err := s.kv.Get(key)
+		switch {
+		case errors.Is(err, nats.ErrKeyNotFound):
+			_, err = s.kv.Create(key, value)
+		case err != nil:
+			return err
+		default:
+			var current models.Kline
+			if json.Unmarshal(entry.Value(), &current) == nil && !supersedes(k, current) {
+				return nil
+			}
+			_, err = s.kv.Update(key, value, entry.Revision())
+		}
+
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, nats.ErrKeyExists) && !isWrongLastSequence(err) {
+			return err
+		}
+		// another writer got there first; re-read and compare again
+	}
+	return fmt.Errorf("gave up after %d concurrent updates", maxPutAttempts)
+}
+
+// Get returns the stored candle of a series, or ErrNoLatestKline.
+func (s *LatestKlineStore) Get(ctx context.Context, exchange, symbol, interval string) (models.Kline, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Kline{}, err
+	}
+
+	entry, err := s.kv.Get(LatestKlineKey(exchange, symbol, interval))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return models.Kline{}, ErrNoLatestKline
+	}
+	if err != nil {
+		return models.Kline{}, err
+	}
+
+	var k models.Kline
+	if err := json.Unmarshal(entry.Value(), &k); err != nil {
+		return models.Kline{}, fmt.Errorf("decode latest kline: %w", err)
+	}
+	return k, nil
+}
+
+// Watch calls fn with the current candle of every series matching filter (see LatestKlineFilter)
+// and then with every update, until ctx is cancelled.
+func (s *LatestKlineStore) Watch(ctx context.Context, filter string, fn func(models.Kline)) error {
+	watcher, err := s.kv.Watch(filter, nats.Context(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = watcher.Stop() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				return nil
+			}
+			// nil marks the end of the initial values; deletes carry no kline
+			if entry == nil || entry.Operation() != nats.KeyValuePut {
+				continue
+			}
+			var k models.Kline
+			if err := json.Unmarshal(entry.Value(), &k); err != nil {
+				utils.Logger.Warn("Skipping undecodable latest kline", zap.String("key", entry.Key()), zap.Error(err))
+				continue
+			}
+			fn(k)
+		}
+	}
+}
+
+// NewestPerSeries keeps, for each exchange/symbol/interval, the kline that supersedes all others,
+// in first-seen order of the series.
+func NewestPerSeries(klines []models.Kline) []models.Kline {
+	index := make(map[string]int)
+	var newest []models.Kline
+	for _, k := range klines {
+		key := LatestKlineKey(k.Exchange, k.Symbol, k.Interval)
+		i, seen := index[key]
+		if !seen {
+			index[key] = len(newest)
+			newest = append(newest, k)
+			continue
+		}
+		if supersedes(k, newest[i]) {
+			newest[i] = k
+		}
+	}
+	return newest
+}
+
+// supersedes reports whether candle k should replace candle current of the same series: it opens
+// later, or it is the same candle and current isn't closed yet (a closed candle is final).
+func supersedes(k, current models.Kline) bool {
+	if !k.Time.Equal(current.Time) {
+		return k.Time.After(current.Time)
+	}
+	return !current.IsClosed
+}
+
+// isWrongLastSequence reports whether err is JetStream's compare-and-set failure of an Update.
+func isWrongLastSequence(err error) bool {
+	var apiErr *nats.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence
+}
@@ -0,0 +1,190 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"infosir/internal/utils"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// ErrIncompatibleConfig is returned when an existing stream or consumer differs from the
+// configuration in a way that can't be changed in place.
+var ErrIncompatibleConfig = errors.New("incompatible JetStream configuration")
+
+var (
+	retentionPolicies = map[string]nats.RetentionPolicy{
+		"limits":    nats.LimitsPolicy,
+		"interest":  nats.InterestPolicy,
+		"workqueue": nats.WorkQueuePolicy,
+	}
+	storageTypes = map[string]nats.StorageType{
+		"file":   nats.FileStorage,
+		"memory": nats.MemoryStorage,
+	}
+	discardPolicies = map[string]nats.DiscardPolicy{
+		"old": nats.DiscardOld,
+		"new": nats.DiscardNew,
+	}
+)
+
+// DesiredStreamConfig returns the kline stream configuration from NATSConfig.
+func DesiredStreamConfig() nats.StreamConfig {
+	cfg := utils.GetConfig().NATS
+	return nats.StreamConfig{
+		Name:       cfg.StreamName,
+		Subjects:   []string{StreamSubject(cfg.Subject)},
+		Retention:  retentionPolicies[cfg.StreamRetention],
+		MaxAge:     cfg.StreamMaxAge,
+		MaxBytes:   cfg.StreamMaxBytes,
+		Storage:    storageTypes[cfg.StreamStorage],
+		Replicas:   cfg.StreamReplicas,
+		Duplicates: cfg.DuplicateWindow,
+		Discard:    discardPolicies[cfg.StreamDiscard],
+	}
+}
+
+// DesiredConsumerConfig returns the configuration of the durable pull consumer storing klines.
+func DesiredConsumerConfig() nats.ConsumerConfig {
+	cfg := utils.GetConfig().NATS
+	return nats.ConsumerConfig{
+		Durable:       cfg.ConsumerName,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+		MaxDeliver:    cfg.MaxDeliver,
+		MaxAckPending: cfg.MaxAckPending,
+		FilterSubject: ConsumerFilterSubject(),
+	}
+}
+
+// ReconcileStreamConfig applies the desired settings to the current configuration of an existing
+// stream. It reports whether anything changed, or returns ErrIncompatibleConfig if the storage type
+// or retention policy differ: those can't be changed without recreating the stream. Subjects of
+// the current stream are kept, so that messages stored under earlier subjects stay reachable.
+func ReconcileStreamConfig(current, desired nats.StreamConfig) (nats.StreamConfig, bool, error) {
+	var conflicts []string
+	if current.Storage != desired.Storage {
+		conflicts = append(conflicts, fmt.Sprintf("storage %s -> %s", current.Storage, desired.Storage))
+	}
+	if current.Retention != desired.Retention {
+		conflicts = append(conflicts, fmt.Sprintf("retention %s -> %s", current.Retention, desired.Retention))
+	}
+	if len(conflicts) > 0 {
+		return current, false, fmt.Errorf("%w: stream %s: %s", ErrIncompatibleConfig, current.Name, strings.Join(conflicts, ", "))
+	}
+
+	updated := current
+	updated.Subjects = slices.Clone(current.Subjects)
+	for _, subject := range desired.Subjects {
+		if !slices.Contains(updated.Subjects, subject) {
+			updated.Subjects = append(updated.Subjects, subject)
+		}
+	}
+	updated.MaxAge = desired.MaxAge
+	updated.MaxBytes = desired.MaxBytes
+	updated.Replicas = desired.Replicas
+	updated.Duplicates = desired.Duplicates
+	updated.Discard = desired.Discard
+
+	changed := len(updated.Subjects) != len(current.Subjects) ||
+		updated.MaxAge != current.MaxAge ||
+		updated.MaxBytes != current.MaxBytes ||
+		updated.Replicas != current.Replicas ||
+		updated.Duplicates != current.Duplicates ||
+		updated.Discard != current.Discard
+	return updated, changed, nil
+}
+
+// ReconcileConsumerConfig applies the desired settings to the current configuration of an existing
+// consumer. It reports whether anything changed, or returns ErrIncompatibleConfig for a push
+// consumer (as created by versions before the pull consumer) or a different ack policy.
+func ReconcileConsumerConfig(current, desired nats.ConsumerConfig) (nats.ConsumerConfig, bool, error) {
+	var conflicts []string
+	if current.DeliverSubject != "" {
+		conflicts = append(conflicts, "push consumer -> pull consumer")
+	}
+	if current.AckPolicy != desired.AckPolicy {
+		conflicts = append(conflicts, fmt.Sprintf("ack policy %s -> %s", current.AckPolicy, desired.AckPolicy))
+	}
+	if len(conflicts) > 0 {
+		return current, false, fmt.Errorf("%w: consumer %s: %s", ErrIncompatibleConfig, current.Durable, strings.Join(conflicts, ", "))
+	}
+
+	updated := current
+	updated.AckWait = desired.AckWait
+	updated.MaxDeliver = desired.MaxDeliver
+	updated.MaxAckPending = desired.MaxAckPending
+	updated.FilterSubject = desired.FilterSubject
+
+	changed := updated.AckWait != current.AckWait ||
+		updated.MaxDeliver != current.MaxDeliver ||
+		updated.MaxAckPending != current.MaxAckPending ||
+		updated.FilterSubject != current.FilterSubject
+	return updated, changed, nil
+}
+
+// ensureStream creates the stream or brings an existing one in line with the desired config.
+func ensureStream(js nats.JetStreamContext, desired nats.StreamConfig) error {
+	info, err := js.StreamInfo(desired.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if _, err := js.AddStream(&desired); err != nil {
+			return fmt.Errorf("AddStream %s error: %w", desired.Name, err)
+		}
+		utils.Logger.Info("Created new JetStream stream", zap.String("stream", desired.Name))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("StreamInfo %s error: %w", desired.Name, err)
+	}
+
+	updated, changed, err := ReconcileStreamConfig(info.Config, desired)
+	if err != nil || !changed {
+		return err
+	}
+	if _, err := js.UpdateStream(&updated); err != nil {
+		return fmt.Errorf("UpdateStream %s error: %w", desired.Name, err)
+	}
+	utils.Logger.Info("Updated JetStream stream",
+		zap.String("stream", desired.Name),
+		zap.Strings("subjects", updated.Subjects),
+		zap.Duration("maxAge", updated.MaxAge),
+		zap.Int64("maxBytes", updated.MaxBytes),
+		zap.Int("replicas", updated.Replicas),
+		zap.Duration("duplicateWindow", updated.Duplicates),
+		zap.Stringer("discard", updated.Discard))
+	return nil
+}
+
+// ensureConsumer creates the durable consumer or brings an existing one in line with the desired config.
+func ensureConsumer(js nats.JetStreamContext, stream string, desired nats.ConsumerConfig) error {
+	info, err := js.ConsumerInfo(stream, desired.Durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		if _, err := js.AddConsumer(stream, &desired); err != nil {
+			return fmt.Errorf("AddConsumer %s error: %w", desired.Durable, err)
+		}
+		utils.Logger.Info("Created new JetStream consumer", zap.String("durableName", desired.Durable))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ConsumerInfo %s error: %w", desired.Durable, err)
+	}
+
+	updated, changed, err := ReconcileConsumerConfig(info.Config, desired)
+	if err != nil || !changed {
+		return err
+	}
+	if _, err := js.UpdateConsumer(stream, &updated); err != nil {
+		return fmt.Errorf("UpdateConsumer %s error: %w", desired.Durable, err)
+	}
+	utils.Logger.Info("Updated JetStream consumer",
+		zap.String("durableName", desired.Durable),
+		zap.String("filterSubject", updated.FilterSubject),
+		zap.Duration("ackWait", updated.AckWait),
+		zap.Int("maxDeliver", updated.MaxDeliver),
+		zap.Int("maxAckPending", updated.MaxAckPending))
+	return nil
+}
@@ -0,0 +1,205 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"infosir/internal/db/repository"
+	"infosir/internal/models"
+	"infosir/internal/utils"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// replayIdleTimeout ends a replay when the stream delivers nothing for that long, e.g. because
+// the start lies past the last message matching the filter.
+const replayIdleTimeout = 5 * time.Second
+
+// ReplayOptions selects the messages of the kline stream to replay into the database.
+type ReplayOptions struct {
+	// StartSeq is the first stream sequence to replay; 0 means the first message.
+	StartSeq uint64
+	// StartTime replays the messages stored at or after it; it can't be combined with StartSeq.
+	StartTime time.Time
+	// Filter restricts the replay to a subject filter within the stream; empty replays every retained
+	// message, including those stored under earlier subjects the stream still lists.
+	Filter string
+	// BatchSize is the number of messages whose klines are merged and inserted together.
+	BatchSize int
+	// DryRun only decodes and counts the messages, nothing is written.
+	DryRun bool
+}
+
+// Validate checks that the options select a single start position and a usable batch size.
+func (o ReplayOptions) Validate() error {
+	if o.StartSeq > 0 && !o.StartTime.IsZero() {
+		return errors.New("replay: start sequence and start time are mutually exclusive")
+	}
+	if o.BatchSize < 1 {
+		return fmt.Errorf("replay: batch size must be positive, got %d", o.BatchSize)
+	}
+	return nil
+}
+
+// ReplayProgress describes how far a replay got.
+type ReplayProgress struct {
+	// Messages is the number of messages read from the stream.
+	Messages uint64 `json:"messages"`
+	// Undecodable is the number of messages skipped because they couldn't be decoded.
+	Undecodable uint64 `json:"undecodable"`
+	// Klines is the number of klines of the stored interval decoded (after merging duplicates).
+	Klines uint64 `json:"klines"`
+	// Stored is the number of klines inserted; it stays 0 in a dry run.
+	Stored uint64 `json:"stored"`
+	// FirstSeq is the stream sequence of the first message read.
+	FirstSeq uint64 `json:"first_seq"`
+	// LastSeq is the stream sequence of the last message read.
+	LastSeq uint64 `json:"last_seq"`
+	// StoredSeq is the stream sequence up to which all klines are stored: resume from StoredSeq+1.
+	StoredSeq uint64 `json:"stored_seq"`
+	// TargetSeq is the last sequence of the stream when the replay started.
+	TargetSeq uint64 `json:"target_seq"`
+	// Elapsed is the time spent so far.
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// Percent returns how much of the sequence range from FirstSeq to TargetSeq has been read.
+func (p ReplayProgress) Percent() float64 {
+	if p.Messages == 0 {
+		return 0
+	}
+	if p.LastSeq >= p.TargetSeq {
+		return 100
+	}
+	return float64(p.LastSeq-p.FirstSeq+1) / float64(p.TargetSeq-p.FirstSeq+1) * 100
+}
+
+// ReplayStream rebuilds stored klines from the messages retained in the kline stream. It reads
+// the stream in order through an ephemeral ordered consumer, from opts.StartSeq or opts.StartTime
+// up to the last message present when it started, and upserts the klines of the stored interval
+// in batches of opts.BatchSize messages. Inserts are idempotent, so the service may keep running.
+// Undecodable messages are logged and skipped. progress, if not nil, is called after every batch.
+// On error, the returned progress tells where to resume (StoredSeq+1).
+func ReplayStream(
+	ctx context.Context,
+	js nats.JetStreamContext,
+	klineRepo *repository.KlineRepository,
+	opts ReplayOptions,
+	progress func(ReplayProgress),
+) (ReplayProgress, error) {
+	var p ReplayProgress
+	if err := opts.Validate(); err != nil {
+		return p, err
+	}
+	if !opts.DryRun && klineRepo == nil {
+		return p, errors.New("replay: a kline repository is required unless dry-running")
+	}
+
+	cfg := utils.GetConfig().NATS
+	info, err := js.StreamInfo(cfg.StreamName, nats.Context(ctx))
+	if err != nil {
+		return p, fmt.Errorf("StreamInfo %s error: %w", cfg.StreamName, err)
+	}
+	p.TargetSeq = info.State.LastSeq
+	if info.State.Msgs == 0 || opts.StartSeq > p.TargetSeq {
+		return p, nil
+	}
+
+	// An empty subject binds to the whole stream without a filter.
+	filter := opts.Filter
+	subOpts := []nats.SubOpt{nats.OrderedConsumer(), nats.BindStream(cfg.StreamName)}
+	switch {
+	case opts.StartSeq > 0:
+		subOpts = append(subOpts, nats.StartSequence(opts.StartSeq))
+	case !opts.StartTime.IsZero():
+		subOpts = append(subOpts, nats.StartTime(opts.StartTime))
+	default:
+		subOpts = append(subOpts, nats.DeliverAll())
+	}
+
+	sub, err := js.SubscribeSync(filter, subOpts...)
+	if err != nil {
+		return p, fmt.Errorf("ordered subscribe to %s %q: %w", cfg.StreamName, filter, err)
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	started := time.Now()
+	batches := make([][]models.Kline, 0, opts.BatchSize)
+	pending := 0
+
+	flush := func() error {
+		klines := storedIntervalOnly(MergeKlines(batches))
+		if !opts.DryRun && len(klines) > 0 {
+			if err := klineRepo.BatchInsertKlines(ctx, klines); err != nil {
+				return fmt.Errorf("insert klines up to sequence %d: %w", p.LastSeq, err)
+			}
+			p.Stored += uint64(len(klines))
+		}
+		p.Klines += uint64(len(klines))
+		p.StoredSeq = p.LastSeq
+		p.Elapsed = time.Since(started)
+		batches, pending = batches[:0], 0
+		if progress != nil {
+			progress(p)
+		}
+		return nil
+	}
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, replayIdleTimeout)
+		msg, err := sub.NextMsgWithContext(waitCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return p, ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) {
+				break // nothing left that matches the filter
+			}
+			return p, fmt.Errorf("read stream: %w", err)
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return p, fmt.Errorf("message metadata: %w", err)
+		}
+		if p.Messages == 0 {
+			p.FirstSeq = meta.Sequence.Stream
+		}
+		p.Messages++
+		p.LastSeq = meta.Sequence.Stream
+		pending++
+
+		klines, err := decodeKlines(msg.Header, msg.Data)
+		if err != nil {
+			p.Undecodable++
+			utils.Logger.Warn("Skipping undecodable message",
+				zap.String("subject", msg.Subject),
+				zap.Uint64("seq", meta.Sequence.Stream),
+				zap.Error(err))
+		} else {
+			batches = append(batches, klines)
+		}
+
+		done := p.LastSeq >= p.TargetSeq || meta.NumPending == 0
+		if pending >= opts.BatchSize || done {
+			if err := flush(); err != nil {
+				return p, err
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	if pending > 0 {
+		if err := flush(); err != nil {
+			return p, err
+		}
+	}
+	p.Elapsed = time.Since(started)
+	return p, nil
+}
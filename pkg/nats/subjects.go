@@ -0,0 +1,62 @@
+package nats
+
+import (
+	"strings"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+)
+
+// Kline subjects follow the hierarchy "<prefix>.<exchange>.<symbol>.<interval>", e.g.
+// "infosir.kline.binance.BTCUSDT.1h", where the prefix is NATS_SUBJECT. The stream captures
+// "<prefix>.>", so consumers can narrow down to the series they need with wildcards, e.g.
+// "infosir.kline.*.BTCUSDT.1h" or "infosir.kline.okx.>".
+
+// KlineSubject returns the subject the kline is published to.
+func KlineSubject(prefix string, k models.Kline) string {
+	return strings.Join([]string{prefix, subjectToken(k.Exchange), subjectToken(k.Symbol), subjectToken(k.Interval)}, ".")
+}
+
+// KlineFilterSubject returns a filter subject for downstream subscribers. Empty arguments
+// match any exchange, symbol or interval.
+func KlineFilterSubject(prefix, exchange, symbol, interval string) string {
+	tokens := []string{prefix}
+	for _, t := range []string{exchange, symbol, interval} {
+		if t == "" {
+			tokens = append(tokens, "*")
+			continue
+		}
+		tokens = append(tokens, subjectToken(t))
+	}
+	return strings.Join(tokens, ".")
+}
+
+// StreamSubject returns the wildcard subject the kline stream captures.
+func StreamSubject(prefix string) string {
+	return prefix + ".>"
+}
+
+// ConsumerFilterSubject returns the subject the storing consumer subscribes to:
+// JETSTREAM_CONSUMER_FILTER if set, otherwise every exchange and symbol of the stored interval.
+func ConsumerFilterSubject() string {
+	cfg := utils.GetConfig()
+	if cfg.NATS.ConsumerFilter != "" {
+		return cfg.NATS.ConsumerFilter
+	}
+	return KlineFilterSubject(cfg.NATS.Subject, "", "", cfg.Crypto.KlineInterval)
+}
+
+// subjectToken makes s usable as a single subject token: separators, wildcards and whitespace
+// become underscores, and an empty value becomes "_".
+func subjectToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
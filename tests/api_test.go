@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"infosir/cmd/handler"
+	"infosir/internal/db/repository"
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	"infosir/tests/mocks"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newKlinesAPI wires the read API onto a mux the same way startHTTPServer does.
+func newKlinesAPI(repo handler.KlineReader) *http.ServeMux {
+	utils.InitLogger()
+	utils.GetConfig().Crypto.BinanceKlinesPoint = "fapi/v1/klines"
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/klines", handler.KlinesHandler(repo, utils.Logger))
+	mux.Handle("GET /api/v1/klines/latest", handler.LatestKlineHandler(repo, utils.Logger))
+	return mux
+}
+
+// TestKlinesAPI_PaginatesWithCursor checks that a full page carries a cursor which continues
+// right after the last returned kline.
+func TestKlinesAPI_PaginatesWithCursor(t *testing.T) {
+	repo := &mocks.MockKlineRepository{}
+	mux := newKlinesAPI(repo)
+
+	inst := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "BTCUSDT"}
+	start := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	klines := make([]models.Kline, 3)
+	for i := range klines {
+		klines[i] = models.Kline{Time: start.Add(time.Duration(i) * time.Hour), Symbol: "BTCUSDT", ClosePrice: decimal.NewFromInt(int64(i))}
+	}
+
+	repo.On("FindAggregated", mock.Anything, inst, models.Interval1h,
+		start, start.Add(24*time.Hour), 3).Return(klines, nil).Once()
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/api/v1/klines?symbol=btcusdt&interval=1h&from=2024-02-01T00:00:00Z&to=2024-02-02T00:00:00Z&limit=2", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page struct {
+		Data       []models.Kline `json:"data"`
+		NextCursor string         `json:"next_cursor"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 2)
+	assert.NotEmpty(t, page.NextCursor)
+	assert.Equal(t, page.NextCursor, rec.Header().Get("X-Next-Cursor"))
+
+	// The cursor replaces 'from' on the next request.
+	repo.On("FindAggregated", mock.Anything, inst, models.Interval1h,
+		mock.MatchedBy(func(from time.Time) bool { return from.Equal(klines[2].Time) }),
+		start.Add(24*time.Hour), 3).Return(klines[2:], nil).Once()
+
+	req = httptest.NewRequest(http.MethodGet,
+		"/api/v1/klines?symbol=BTCUSDT&interval=1h&to=2024-02-02T00:00:00Z&limit=2&cursor="+page.NextCursor, nil)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	page.NextCursor = ""
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 1)
+	assert.Empty(t, page.NextCursor)
+	repo.AssertExpectations(t)
+}
+
+// TestKlinesAPI_CSV checks the CSV response format.
+func TestKlinesAPI_CSV(t *testing.T) {
+	repo := &mocks.MockKlineRepository{}
+	mux := newKlinesAPI(repo)
+
+	k := models.Kline{
+		Time:       time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		Exchange:   models.ExchangeBinance,
+		Market:     models.MarketFutures,
+		Symbol:     "BTCUSDT",
+		ClosePrice: decimal.RequireFromString("0.00001234"),
+	}
+	repo.On("FindAggregated", mock.Anything, mock.Anything, models.Interval1m,
+		mock.Anything, mock.Anything, defaultLimitPlusOne).Return([]models.Kline{k}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/klines?symbol=BTCUSDT&format=csv", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/csv")
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "time", rows[0][0])
+	assert.Equal(t, "2024-02-01T00:00:00Z", rows[1][0])
+	assert.Equal(t, "0.00001234", rows[1][9])
+}
+
+// defaultLimitPlusOne is the page size the handler asks the repository for when no limit is given.
+const defaultLimitPlusOne = 501
+
+// TestKlinesAPI_ValidationErrors checks that bad input yields a 400 with the standard error body
+// and never reaches the repository.
+func TestKlinesAPI_ValidationErrors(t *testing.T) {
+	repo := &mocks.MockKlineRepository{}
+	mux := newKlinesAPI(repo)
+
+	for _, query := range []string{
+		"",                                   // missing symbol
+		"symbol=BTCUSDT&interval=7m",         // unsupported interval
+		"symbol=BTCUSDT&limit=0",             // limit out of range
+		"symbol=BTCUSDT&limit=5000",          // limit out of range
+		"symbol=BTCUSDT&from=yesterday",      // bad timestamp
+		"symbol=BTCUSDT&from=2000&to=1000",   // inverted range
+		"symbol=BTCUSDT&exchange=kraken",     // unknown exchange
+		"symbol=BTCUSDT&cursor=not-a-cursor", // bad cursor
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/klines?"+query, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body), query)
+		assert.Equal(t, "invalid_argument", body.Error.Code, query)
+		assert.NotEmpty(t, body.Error.Message, query)
+	}
+	repo.AssertNotCalled(t, "FindAggregated")
+}
+
+// TestKlinesAPI_Latest checks the latest endpoint, including the 404 for an unknown series.
+func TestKlinesAPI_Latest(t *testing.T) {
+	repo := &mocks.MockKlineRepository{}
+	mux := newKlinesAPI(repo)
+
+	btc := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "BTCUSDT"}
+	eth := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketSpot, Symbol: "ETHUSDT"}
+	repo.On("FindLast", mock.Anything, btc).Return(models.Kline{Symbol: "BTCUSDT", ClosePrice: decimal.NewFromInt(42)}, nil)
+	repo.On("FindLast", mock.Anything, eth).Return(models.Kline{}, repository.ErrNotFound)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/klines/latest?symbol=BTCUSDT", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Data models.Kline `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.True(t, decimal.NewFromInt(42).Equal(body.Data.ClosePrice))
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/klines/latest?symbol=ETHUSDT&market=spot", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"not_found"`)
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"infosir/cmd/handler"
+	"infosir/internal/jobs"
+	"infosir/internal/models"
+	"infosir/internal/srv"
+	"infosir/internal/utils"
+	"infosir/tests/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newBackfillManager builds a manager over an in-memory store and mocked exchange and repository.
+func newBackfillManager(t *testing.T) (*jobs.BackfillManager, *mocks.MemoryBackfillStore, *mocks.MockBinanceClient, *mocks.MockKlineRepository) {
+	t.Helper()
+	utils.InitLogger()
+	cfg := utils.GetConfig()
+	cfg.Crypto.KlineInterval = "1m"
+	cfg.BackfillConcurrency = 2
+
+	store := mocks.NewMemoryBackfillStore()
+	client := &mocks.MockBinanceClient{}
+	repo := &mocks.MockKlineRepository{}
+	exchanges := srv.NewExchangeRegistry()
+	exchanges.Register(models.ExchangeBinance, client)
+
+	return jobs.NewBackfillManager(store, repo, exchanges), store, client, repo
+}
+
+// waitForStatus polls the store until the job reaches the status or the test times out.
+func waitForStatus(t *testing.T, store *mocks.MemoryBackfillStore, id int64, status models.BackfillStatus) models.BackfillJob {
+	t.Helper()
+	var job models.BackfillJob
+	require.Eventually(t, func() bool {
+		job, _ = store.Get(context.Background(), id)
+		return job.Status == status
+	}, 2*time.Second, 5*time.Millisecond, "job %d should become %s", id, status)
+	return job
+}
+
+// TestBackfillManager_RunsToDoneWithCheckpoints checks that a submitted job stores every chunk and
+// finishes with its cursor past the end of the range.
+func TestBackfillManager_RunsToDoneWithCheckpoints(t *testing.T) {
+	manager, store, client, repo := newBackfillManager(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, manager.Start(ctx))
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Minute)
+	klines := []models.Kline{{Time: from}, {Time: from.Add(time.Minute)}, {Time: to}}
+
+	client.On("FetchKlinesRange", mock.Anything, "BTCUSDT", "1m", from, to, int64(1000)).Return(klines, nil)
+	repo.On("BatchInsertKlines", mock.Anything, klines).Return(nil)
+
+	job, err := manager.Submit(ctx, jobs.BackfillRequest{Pair: "BTCUSDT", From: from, To: to})
+	require.NoError(t, err)
+	assert.Equal(t, models.ExchangeBinance, job.Exchange)
+
+	done := waitForStatus(t, store, job.ID, models.BackfillDone)
+	assert.Equal(t, int64(3), done.Fetched)
+	assert.True(t, done.Cursor.After(to))
+	manager.Wait()
+}
+
+// TestBackfillManager_ResumesFromCheckpoint checks that a job left running by a previous process
+// continues from its cursor rather than from the start of its range.
+func TestBackfillManager_ResumesFromCheckpoint(t *testing.T) {
+	manager, store, client, repo := newBackfillManager(t)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cursor := from.Add(time.Hour)
+	to := cursor.Add(time.Minute)
+	store.Put(models.BackfillJob{
+		ID: 7, Exchange: models.ExchangeBinance, Pair: "ETHUSDT", Interval: "1m",
+		Start: from, End: to, Cursor: cursor, Fetched: 60, Status: models.BackfillRunning,
+	})
+
+	klines := []models.Kline{{Time: cursor}, {Time: to}}
+	client.On("FetchKlinesRange", mock.Anything, "ETHUSDT", "1m", cursor, to, int64(1000)).Return(klines, nil)
+	repo.On("BatchInsertKlines", mock.Anything, klines).Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, manager.Start(ctx))
+
+	done := waitForStatus(t, store, 7, models.BackfillDone)
+	assert.Equal(t, int64(62), done.Fetched)
+	client.AssertExpectations(t)
+	manager.Wait()
+}
+
+// TestBackfillManager_PauseAndResume checks that pausing stops a running job and resuming finishes it.
+func TestBackfillManager_PauseAndResume(t *testing.T) {
+	manager, store, client, repo := newBackfillManager(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, manager.Start(ctx))
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Minute)
+	klines := []models.Kline{{Time: from}, {Time: to}}
+
+	// The first fetch hangs until the job is paused.
+	started := make(chan struct{})
+	client.On("FetchKlinesRange", mock.Anything, "BTCUSDT", "1m", from, to, int64(1000)).
+		Run(func(args mock.Arguments) {
+			close(started)
+			<-args.Get(0).(context.Context).Done()
+		}).
+		Return(nil, context.Canceled).Once()
+	client.On("FetchKlinesRange", mock.Anything, "BTCUSDT", "1m", from, to, int64(1000)).Return(klines, nil)
+	repo.On("BatchInsertKlines", mock.Anything, klines).Return(nil)
+
+	job, err := manager.Submit(ctx, jobs.BackfillRequest{Pair: "BTCUSDT", From: from, To: to})
+	require.NoError(t, err)
+	<-started
+
+	_, err = manager.Pause(ctx, job.ID)
+	require.NoError(t, err)
+	waitForStatus(t, store, job.ID, models.BackfillPaused)
+
+	_, err = manager.Resume(ctx, job.ID)
+	require.NoError(t, err)
+	waitForStatus(t, store, job.ID, models.BackfillDone)
+
+	// A finished job can be neither resumed nor cancelled.
+	_, err = manager.Resume(ctx, job.ID)
+	assert.ErrorIs(t, err, jobs.ErrBackfillState)
+	_, err = manager.Cancel(ctx, job.ID)
+	assert.ErrorIs(t, err, jobs.ErrBackfillState)
+	manager.Wait()
+}
+
+// TestBackfillHandlers checks request validation and error mapping of the backfill API.
+func TestBackfillHandlers(t *testing.T) {
+	manager, _, _, _ := newBackfillManager(t)
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/v1/backfills", handler.SubmitBackfillHandler(manager, utils.Logger))
+	mux.Handle("GET /api/v1/backfills/{id}", handler.GetBackfillHandler(manager, utils.Logger))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/backfills",
+		strings.NewReader(`{"pair":"BTCUSDT","interval":"1h","from":"2024-01-01T00:00:00Z","to":"2024-01-02T00:00:00Z"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "only the stored interval can be backfilled")
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/backfills",
+		strings.NewReader(`{"pair":"BTCUSDT","from":"2024-01-01T00:00:00Z","to":"2024-01-02T00:00:00Z"}`)))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"pending"`)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/backfills/1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/backfills/99", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
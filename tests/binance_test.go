@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	"infosir/pkg/crypto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeBinance starts an httptest server and points the global crypto config at it.
+func newFakeBinance(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	utils.InitLogger()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg := utils.GetConfig()
+	cfg.Crypto.BinanceBaseURL = srv.URL
+	cfg.Crypto.BinanceKlinesPoint = "fapi/v1/klines"
+	cfg.Crypto.BinanceWeightLimit = 2400
+	return srv
+}
+
+// TestBinanceClient_BacksOffOn429 checks that a 429 with Retry-After blocks the client for
+// the advertised time and that the request is retried afterwards.
+func TestBinanceClient_BacksOffOn429(t *testing.T) {
+	var calls int32
+	newFakeBinance(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "5")
+		_, _ = fmt.Fprint(w, `[[1704067200000,"1.0","2.0","0.5","1.5","10",1704067259999,"15",3,"4","6","0"]]`)
+	})
+
+	client := crypto.NewBinanceClient()
+
+	started := time.Now()
+	klines, err := client.FetchKlines(context.Background(), "BTCUSDT", "1m", 1)
+
+	assert.NoError(t, err)
+	assert.Len(t, klines, 1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "request should be retried once")
+	assert.GreaterOrEqual(t, time.Since(started), time.Second, "client should honour Retry-After")
+}
+
+// TestBinanceClient_SendsTimeRange checks that FetchKlinesRange passes startTime/endTime in ms.
+func TestBinanceClient_SendsTimeRange(t *testing.T) {
+	var query string
+	newFakeBinance(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		_, _ = fmt.Fprint(w, `[]`)
+	})
+
+	start := time.UnixMilli(1704067200000)
+	end := start.Add(time.Hour)
+	_, err := crypto.NewBinanceClient().FetchKlinesRange(context.Background(), "ETHUSDT", "1m", start, end, 500)
+
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(query, "startTime=1704067200000"), query)
+	assert.True(t, strings.Contains(query, "endTime=1704070800000"), query)
+	assert.True(t, strings.Contains(query, "limit=500"), query)
+}
+
+// TestWeightLimiter_BlocksWhenBudgetExhausted checks that callers block once the minute budget is
+// spent and get through again as soon as the next minute window starts.
+func TestWeightLimiter_BlocksWhenBudgetExhausted(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	limiter := crypto.NewWeightLimiter(10).WithClock(func() time.Time { return now })
+	assert.NoError(t, limiter.Wait(context.Background(), 6))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx, 6), context.DeadlineExceeded)
+
+	now = now.Add(29 * time.Second) // 12:00:59, still the same window
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx, 6), context.DeadlineExceeded)
+
+	now = now.Add(time.Second) // 12:01:00, the window rolls over
+	assert.NoError(t, limiter.Wait(context.Background(), 6))
+}
+
+// TestBinanceClient_KeepsExactDecimals checks that tiny prices survive parsing and a JSON
+// round trip (the NATS wire format) without any loss of precision.
+func TestBinanceClient_KeepsExactDecimals(t *testing.T) {
+	newFakeBinance(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `[[1704067200000,"0.000012345678901234","0.000012345678901299","0.000012345678901200",`+
+			`"0.000012345678901255","123456789012.123456789",1704067259999,"1.5",3,"4","6","0"]]`)
+	})
+
+	klines, err := crypto.NewBinanceClient().FetchKlines(context.Background(), "NILUSDT", "1m", 1)
+	assert.NoError(t, err)
+	if !assert.Len(t, klines, 1) {
+		return
+	}
+	assert.Equal(t, "0.000012345678901255", klines[0].ClosePrice.String())
+	assert.Equal(t, "123456789012.123456789", klines[0].Volume.String())
+
+	data, err := json.Marshal(klines)
+	assert.NoError(t, err)
+	var decoded []models.Kline
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.True(t, klines[0].ClosePrice.Equal(decoded[0].ClosePrice))
+	assert.Contains(t, string(data), `"close":"0.000012345678901255"`)
+}
+
+// TestBinanceClient_SurfacesParseErrors checks that invalid numbers fail the fetch instead of becoming zeros.
+func TestBinanceClient_SurfacesParseErrors(t *testing.T) {
+	newFakeBinance(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `[[1704067200000,"1.0","oops","0.5","1.5","10",1704067259999,"15",3,"4","6","0"]]`)
+	})
+
+	_, err := crypto.NewBinanceClient().FetchKlines(context.Background(), "BTCUSDT", "1m", 1)
+	assert.ErrorContains(t, err, "oops")
+}
+
+// TestBinanceClient_MarksTrailingCandleOpen checks that a candle whose close time lies in the
+// future is flagged as open while earlier candles are closed.
+func TestBinanceClient_MarksTrailingCandleOpen(t *testing.T) {
+	open := time.Now().Truncate(time.Minute)
+	newFakeBinance(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `[[%d,"1","2","0.5","1.5","10",%d,"15",3,"4","6","0"],[%d,"1","2","0.5","1.5","10",%d,"15",3,"4","6","0"]]`,
+			open.Add(-time.Minute).UnixMilli(), open.UnixMilli()-1,
+			open.UnixMilli(), open.Add(time.Minute).UnixMilli()-1)
+	})
+
+	klines, err := crypto.NewBinanceClient().FetchKlines(context.Background(), "BTCUSDT", "1m", 2)
+
+	assert.NoError(t, err)
+	if assert.Len(t, klines, 2) {
+		assert.True(t, klines[0].IsClosed)
+		assert.False(t, klines[1].IsClosed)
+		assert.Equal(t, open.Add(time.Minute-time.Millisecond), klines[1].CloseTime)
+	}
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	"infosir/pkg/crypto"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// wsKlineEvent is a kline event verbatim from the Binance USD-M futures documentation, wrapped in
+// the combined-stream envelope. Note "L" (last trade id, a number) next to "l" (low price).
+const wsKlineEvent = `{"stream":"btcusdt@kline_1m","data":{
+  "e": "kline",
+  "E": 1638747660000,
+  "s": "BTCUSDT",
+  "k": {
+    "t": 1638747660000,
+    "T": 1638747719999,
+    "s": "BTCUSDT",
+    "i": "1m",
+    "f": 100,
+    "L": 200,
+    "o": "0.0010",
+    "c": "0.0020",
+    "h": "0.0025",
+    "l": "0.0015",
+    "v": "1000",
+    "n": 100,
+    "x": false,
+    "q": "1.0000",
+    "V": "500",
+    "Q": "0.500",
+    "B": "123456"
+  }
+}}`
+
+// TestBinanceStreamClient_ResubscribesAfterReconnect runs the stream client against a local fake
+// WebSocket server which drops the first connection, and checks that the client reconnects,
+// subscribes again and delivers klines from both connections.
+func TestBinanceStreamClient_ResubscribesAfterReconnect(t *testing.T) {
+	utils.InitLogger()
+
+	var subscribes int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var req struct {
+			Method string   `json:"method"`
+			Params []string `json:"params"`
+			ID     int64    `json:"id"`
+		}
+		if err := conn.ReadJSON(&req); err != nil || req.Method != "SUBSCRIBE" {
+			return
+		}
+		n := atomic.AddInt32(&subscribes, 1)
+		_ = conn.WriteJSON(map[string]interface{}{"result": nil, "id": req.ID})
+		_ = conn.WriteMessage(websocket.PingMessage, []byte("ping"))
+
+		event := wsKlineEvent
+		if n > 1 {
+			event = strings.Replace(wsKlineEvent, `"x": false`, `"x": true`, 1)
+		}
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(event))
+
+		if n == 1 {
+			return // drop the first connection to force a reconnect
+		}
+		_, _, _ = conn.ReadMessage() // keep the second one open until the client goes away
+	}))
+	defer srv.Close()
+
+	utils.GetConfig().Crypto.BinanceWSURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	stream := crypto.NewBinanceStreamClient([]string{"BTCUSDT"}, "1m")
+	assert.Equal(t, []string{"btcusdt@kline_1m"}, stream.Streams())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var got []models.Kline
+	var closedFlags []bool
+	err := stream.Run(ctx, func(_ context.Context, k models.Kline) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, k)
+		closedFlags = append(closedFlags, k.IsClosed)
+		if len(got) == 2 {
+			cancel()
+		}
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&subscribes), "client should resubscribe after reconnect")
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, []bool{false, true}, closedFlags)
+		assert.Equal(t, "BTCUSDT", got[1].Symbol)
+		assert.Equal(t, time.UnixMilli(1638747660000), got[1].Time)
+		assert.Equal(t, time.UnixMilli(1638747719999), got[1].CloseTime)
+		assert.Equal(t, "0.002", got[1].ClosePrice.String())
+		assert.Equal(t, "0.0015", got[1].LowPrice.String())
+		assert.Equal(t, int64(100), got[1].Trades)
+	}
+}
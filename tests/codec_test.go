@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"infosir/internal/models"
+	natsinfosir "infosir/pkg/nats"
+
+	"github.com/nats-io/nats.go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var codecNames = []string{"json", "msgpack", "protobuf"}
+
+// sampleKlines returns n consecutive closed 1m klines with realistic precision.
+func sampleKlines(n int) []models.Kline {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	klines := make([]models.Kline, n)
+	for i := range klines {
+		open := start.Add(time.Duration(i) * time.Minute)
+		klines[i] = models.Kline{
+			Time:                open,
+			CloseTime:           models.CloseTimeFor(open, time.Minute),
+			IsClosed:            true,
+			Exchange:            models.ExchangeBinance,
+			Market:              models.MarketFutures,
+			Symbol:              "BTCUSDT",
+			Interval:            "1m",
+			OpenPrice:           decimal.RequireFromString("61234.50"),
+			HighPrice:           decimal.RequireFromString("61300.10"),
+			LowPrice:            decimal.RequireFromString("61200.00"),
+			ClosePrice:          decimal.RequireFromString("61288.90"),
+			Volume:              decimal.RequireFromString("123.456"),
+			QuoteVolume:         decimal.RequireFromString("7561234.123456"),
+			Trades:              int64(1000 + i),
+			TakerBuyBaseVolume:  decimal.RequireFromString("61.2"),
+			TakerBuyQuoteVolume: decimal.RequireFromString("3750000.5"),
+		}
+	}
+	return klines
+}
+
+// assertSameKlines compares klines field by field; decimals and times by value.
+func assertSameKlines(t *testing.T, want, got []models.Kline) {
+	t.Helper()
+	require.Len(t, got, len(want))
+	for i := range want {
+		w, g := want[i], got[i]
+		assert.True(t, w.Time.Equal(g.Time), "time %d", i)
+		assert.True(t, w.CloseTime.Equal(g.CloseTime), "close time %d", i)
+		assert.Equal(t, w.IsClosed, g.IsClosed)
+		assert.Equal(t, w.Instrument(), g.Instrument())
+		assert.Equal(t, w.Interval, g.Interval)
+		assert.Equal(t, w.Trades, g.Trades)
+		for _, pair := range [][2]decimal.Decimal{
+			{w.OpenPrice, g.OpenPrice}, {w.HighPrice, g.HighPrice}, {w.LowPrice, g.LowPrice}, {w.ClosePrice, g.ClosePrice},
+			{w.Volume, g.Volume}, {w.QuoteVolume, g.QuoteVolume}, {w.TakerBuyBaseVolume, g.TakerBuyBaseVolume}, {w.TakerBuyQuoteVolume, g.TakerBuyQuoteVolume},
+		} {
+			assert.True(t, pair[0].Equal(pair[1]), "kline %d: %s != %s", i, pair[0], pair[1])
+		}
+	}
+}
+
+// TestCodecs_RoundTrip checks that every codec reproduces the klines exactly and that a message
+// is decoded with the codec named by its Content-Type header.
+func TestCodecs_RoundTrip(t *testing.T) {
+	klines := sampleKlines(3)
+	klines[2].IsClosed = false
+	klines[2].CloseTime = time.Time{}
+	klines[2].OpenPrice = decimal.RequireFromString("0.00000123")
+
+	for _, name := range codecNames {
+		t.Run(name, func(t *testing.T) {
+			codec, err := natsinfosir.CodecByName(name)
+			require.NoError(t, err)
+
+			env := natsinfosir.NewKlineEnvelope("batch-1", klines)
+			msg, err := natsinfosir.NewKlinesMsg("infosir.kline.binance.BTCUSDT.1m", codec, env)
+			require.NoError(t, err)
+			assert.Equal(t, "2", msg.Header.Get(natsinfosir.HeaderSchemaVersion))
+
+			byHeader, err := natsinfosir.CodecForHeader(msg.Header)
+			require.NoError(t, err)
+			assert.Equal(t, name, byHeader.Name())
+
+			decoded, err := natsinfosir.DecodeEnvelope(msg.Header, msg.Data)
+			require.NoError(t, err)
+			assert.Equal(t, natsinfosir.SchemaVersion, decoded.SchemaVersion)
+			assert.Equal(t, models.ExchangeBinance, decoded.Exchange)
+			assert.Equal(t, "1m", decoded.Interval)
+			assert.Equal(t, "batch-1", decoded.BatchID)
+			assert.WithinDuration(t, env.ProducedAt, decoded.ProducedAt, time.Millisecond)
+			assertSameKlines(t, klines, decoded.Klines)
+		})
+	}
+
+	codec, err := natsinfosir.CodecForHeader(nats.Header{})
+	require.NoError(t, err)
+	assert.Equal(t, "json", codec.Name(), "messages without Content-Type are JSON")
+
+	_, err = natsinfosir.CodecForHeader(nats.Header{natsinfosir.HeaderContentType: {"text/xml"}})
+	assert.Error(t, err)
+}
+
+// BenchmarkCodecs compares payload size (bytes/kline) and encode/decode throughput of the codecs
+// for a scheduler-sized and a backfill-sized batch.
+func BenchmarkCodecs(b *testing.B) {
+	for _, size := range []int{1, 100} {
+		klines := sampleKlines(size)
+		for _, name := range codecNames {
+			codec, err := natsinfosir.CodecByName(name)
+			require.NoError(b, err)
+			env := natsinfosir.NewKlineEnvelope("", klines)
+			data, err := codec.Encode(env)
+			require.NoError(b, err)
+
+			b.Run(fmt.Sprintf("%s/encode/%d", name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				b.ReportMetric(float64(len(data))/float64(size), "bytes/kline")
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Encode(env); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run(fmt.Sprintf("%s/decode/%d", name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				b.ReportMetric(float64(len(data))/float64(size), "bytes/kline")
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Decode(natsinfosir.SchemaVersion, data); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	natsinfosir "infosir/pkg/nats"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMergeKlines_DeduplicatesBatch checks that klines repeated across the messages of a batch
+// collapse into one, preferring closed candles and otherwise the latest delivery.
+func TestMergeKlines_DeduplicatesBatch(t *testing.T) {
+	open := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kline := func(symbol string, at time.Time, closePrice int64, closed bool) models.Kline {
+		return models.Kline{
+			Time:       at,
+			Exchange:   models.ExchangeBinance,
+			Market:     models.MarketFutures,
+			Symbol:     symbol,
+			Interval:   "1m",
+			ClosePrice: decimal.NewFromInt(closePrice),
+			IsClosed:   closed,
+		}
+	}
+
+	merged := natsinfosir.MergeKlines([][]models.Kline{
+		{kline("BTCUSDT", open, 1, false), kline("ETHUSDT", open, 10, true)},
+		{kline("BTCUSDT", open, 2, true), kline("BTCUSDT", open.Add(time.Minute), 3, false)},
+		{kline("BTCUSDT", open, 4, false), kline("ETHUSDT", open, 11, true)},
+		{kline("BTCUSDT", open.Add(time.Minute), 5, false)},
+	})
+
+	if assert.Len(t, merged, 3) {
+		assert.Equal(t, "BTCUSDT", merged[0].Symbol)
+		assert.True(t, decimal.NewFromInt(2).Equal(merged[0].ClosePrice), "closed candle beats a later open one")
+		assert.Equal(t, "ETHUSDT", merged[1].Symbol)
+		assert.True(t, decimal.NewFromInt(11).Equal(merged[1].ClosePrice), "later closed candle wins")
+		assert.True(t, decimal.NewFromInt(5).Equal(merged[2].ClosePrice), "later open candle wins")
+	}
+
+	spot := kline("BTCUSDT", open, 6, true)
+	spot.Market = models.MarketSpot
+	assert.Len(t, natsinfosir.MergeKlines([][]models.Kline{{kline("BTCUSDT", open, 1, true)}, {spot}}), 2,
+		"different markets are different series")
+}
+
+// rejectingStore is a KlineTxStore whose transactions fail if they hold a kline of the rejected symbol.
+type rejectingStore struct {
+	rejected string
+	stored   []models.Kline
+	txs      int
+}
+
+func (s *rejectingStore) StoreKlinesTx(_ context.Context, klines []models.Kline) error {
+	s.txs++
+	for _, k := range klines {
+		if k.Symbol == s.rejected {
+			return errors.New("value out of range")
+		}
+	}
+	s.stored = append(s.stored, klines...)
+	return nil
+}
+
+// TestStoreBatches_IsolatesRejectedMessage checks that a kline the database rejects fails only the
+// message carrying it, while the other messages of the batch are stored.
+func TestStoreBatches_IsolatesRejectedMessage(t *testing.T) {
+	utils.GetConfig().Crypto.KlineInterval = "1m"
+	open := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kline := func(symbol string) []models.Kline {
+		return []models.Kline{{
+			Time:     open,
+			Exchange: models.ExchangeBinance,
+			Market:   models.MarketFutures,
+			Symbol:   symbol,
+			Interval: "1m",
+			IsClosed: true,
+		}}
+	}
+
+	store := &rejectingStore{rejected: "BADUSDT"}
+	errs := natsinfosir.StoreBatches(context.Background(), store, [][]models.Kline{
+		kline("BTCUSDT"), kline("ETHUSDT"), kline("BADUSDT"), kline("SOLUSDT"), kline("XRPUSDT"),
+	})
+
+	if assert.Len(t, errs, 5) {
+		for i, err := range errs {
+			if i == 2 {
+				assert.Error(t, err, "the rejected message fails")
+			} else {
+				assert.NoError(t, err, "message %d is stored", i)
+			}
+		}
+	}
+	assert.Len(t, store.stored, 4)
+
+	store = &rejectingStore{}
+	assert.Equal(t, make([]error, 2), natsinfosir.StoreBatches(context.Background(), store,
+		[][]models.Kline{kline("BTCUSDT"), kline("ETHUSDT")}))
+	assert.Equal(t, 1, store.txs, "a healthy batch is stored in one transaction")
+}
@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	natsinfosir "infosir/pkg/nats"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRetryPolicy_BacksOffExponentially checks the NAK delays and when retrying stops.
+func TestRetryPolicy_BacksOffExponentially(t *testing.T) {
+	p := natsinfosir.RetryPolicy{MaxDeliver: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	assert.Equal(t, time.Second, p.Delay(1))
+	assert.Equal(t, 2*time.Second, p.Delay(2))
+	assert.Equal(t, 4*time.Second, p.Delay(3))
+	assert.Equal(t, 5*time.Second, p.Delay(4), "delay is capped")
+	assert.Equal(t, 5*time.Second, p.Delay(60), "delay stays capped")
+
+	assert.False(t, p.Exhausted(4))
+	assert.True(t, p.Exhausted(5))
+}
+
+// TestDeadLetterMsg_CarriesErrorHeaders checks that the dead-letter copy keeps payload and headers
+// and records why and where the message failed.
+func TestDeadLetterMsg_CarriesErrorHeaders(t *testing.T) {
+	msg := nats.NewMsg("infosir_kline")
+	msg.Data = []byte(`not json`)
+	msg.Header.Set("Nats-Msg-Id", "abc")
+	// A JetStream delivery: stream, consumer, delivered, stream seq, consumer seq, timestamp, pending.
+	msg.Reply = "$JS.ACK.infosir_kline_stream.infosir_kline_consumer.3.42.40.1700000000000000000.0"
+	msg.Sub = &nats.Subscription{}
+
+	dead := natsinfosir.DeadLetterMsg(msg, "infosir_kline_dlq", natsinfosir.DLQReasonUndecodable, errors.New("bad payload"))
+
+	assert.Equal(t, "infosir_kline_dlq", dead.Subject)
+	assert.Equal(t, msg.Data, dead.Data)
+	assert.Equal(t, "abc", dead.Header.Get("Nats-Msg-Id"))
+	assert.Equal(t, natsinfosir.DLQReasonUndecodable, dead.Header.Get(natsinfosir.HeaderDLQReason))
+	assert.Equal(t, "bad payload", dead.Header.Get(natsinfosir.HeaderDLQError))
+	assert.Equal(t, "infosir_kline", dead.Header.Get(natsinfosir.HeaderDLQOriginalSubject))
+	assert.Equal(t, "infosir_kline_stream", dead.Header.Get(natsinfosir.HeaderDLQOriginalStream))
+	assert.Equal(t, "42", dead.Header.Get(natsinfosir.HeaderDLQOriginalSeq))
+	assert.Equal(t, "3", dead.Header.Get(natsinfosir.HeaderDLQDeliveries))
+	assert.NotEmpty(t, dead.Header.Get(natsinfosir.HeaderDLQFailedAt))
+}
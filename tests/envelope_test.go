@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"infosir/internal/models"
+	natsinfosir "infosir/pkg/nats"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// These tests pin the compatibility rules of the kline message schema (see SchemaVersion):
+// older versions stay decodable, unknown fields are ignored, newer versions are rejected.
+
+// headerFor returns the headers of a message of the given codec and schema version.
+func headerFor(contentType, version string) nats.Header {
+	h := nats.Header{}
+	if contentType != "" {
+		h.Set(natsinfosir.HeaderContentType, contentType)
+	}
+	if version != "" {
+		h.Set(natsinfosir.HeaderSchemaVersion, version)
+	}
+	return h
+}
+
+// TestEnvelope_DecodesVersion1 checks that payloads of schema version 1, a bare JSON array of
+// klines, still decode, and that the binary codecs, which never wrote version 1, reject it.
+func TestEnvelope_DecodesVersion1(t *testing.T) {
+	want := sampleKlines(2)
+
+	// A bare array, published before there were any headers.
+	data, err := json.Marshal(want)
+	require.NoError(t, err)
+	env, err := natsinfosir.DecodeEnvelope(nats.Header{}, data)
+	require.NoError(t, err)
+	assert.Equal(t, natsinfosir.SchemaV1, env.SchemaVersion)
+	assert.Equal(t, models.ExchangeBinance, env.Exchange, "taken from the klines")
+	assert.Equal(t, "1m", env.Interval)
+	assertSameKlines(t, want, env.Klines)
+
+	for _, contentType := range []string{natsinfosir.ContentTypeMsgpack, natsinfosir.ContentTypeProtobuf} {
+		_, err = natsinfosir.DecodeEnvelope(headerFor(contentType, "1"), data)
+		assert.ErrorIs(t, err, natsinfosir.ErrUnsupportedSchema, contentType)
+	}
+}
+
+// TestEnvelope_IgnoresUnknownFields checks that fields added by a newer producer of the same
+// schema version don't break decoding.
+func TestEnvelope_IgnoresUnknownFields(t *testing.T) {
+	want := sampleKlines(1)
+	env := natsinfosir.NewKlineEnvelope("batch-1", want)
+
+	// JSON: an extra envelope and kline field.
+	var doc map[string]any
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &doc))
+	doc["source_region"] = "eu-west-1"
+	doc["klines"].([]any)[0].(map[string]any)["vwap"] = "61250.00"
+	data, err = json.Marshal(doc)
+	require.NoError(t, err)
+	decoded, err := natsinfosir.DecodeEnvelope(headerFor(natsinfosir.ContentTypeJSON, "2"), data)
+	require.NoError(t, err)
+	assert.Equal(t, "batch-1", decoded.BatchID)
+	assertSameKlines(t, want, decoded.Klines)
+
+	// MessagePack: an extra envelope and kline key.
+	codec, err := natsinfosir.CodecByName("msgpack")
+	require.NoError(t, err)
+	data, err = codec.Encode(env)
+	require.NoError(t, err)
+	var m map[string]any
+	require.NoError(t, msgpack.Unmarshal(data, &m))
+	m["r"] = "eu-west-1"
+	m["k"].([]any)[0].(map[string]any)["w"] = "61250.00"
+	data, err = msgpack.Marshal(m)
+	require.NoError(t, err)
+	decoded, err = natsinfosir.DecodeEnvelope(headerFor(natsinfosir.ContentTypeMsgpack, "2"), data)
+	require.NoError(t, err)
+	assertSameKlines(t, want, decoded.Klines)
+
+	// Protobuf: an unknown envelope field.
+	codec, err = natsinfosir.CodecByName("protobuf")
+	require.NoError(t, err)
+	data, err = codec.Encode(env)
+	require.NoError(t, err)
+	data = protowire.AppendTag(data, 99, protowire.BytesType)
+	data = protowire.AppendString(data, "eu-west-1")
+	decoded, err = natsinfosir.DecodeEnvelope(headerFor(natsinfosir.ContentTypeProtobuf, "2"), data)
+	require.NoError(t, err)
+	assertSameKlines(t, want, decoded.Klines)
+}
+
+// TestEnvelope_RejectsNewerVersions checks that unknown schema versions fail instead of being guessed.
+func TestEnvelope_RejectsNewerVersions(t *testing.T) {
+	for _, version := range []string{"3", "0", "two"} {
+		_, err := natsinfosir.DecodeEnvelope(headerFor(natsinfosir.ContentTypeJSON, version), []byte(`{}`))
+		assert.ErrorIs(t, err, natsinfosir.ErrUnsupportedSchema, version)
+	}
+}
+
+// TestEnvelope_KlinesInheritEnvelopeFields checks that klines without an exchange or interval
+// belong to the envelope's, so producers may leave them out.
+func TestEnvelope_KlinesInheritEnvelopeFields(t *testing.T) {
+	data := []byte(`{"schema_version":2,"exchange":"okx","interval":"1h","batch_id":"b",
+		"klines":[{"time":"2024-03-01T00:00:00Z","market":"spot","symbol":"BTC-USDT","close":"1"}]}`)
+
+	env, err := natsinfosir.DecodeEnvelope(headerFor(natsinfosir.ContentTypeJSON, "2"), data)
+	require.NoError(t, err)
+	require.Len(t, env.Klines, 1)
+	assert.Equal(t, models.ExchangeOKX, env.Klines[0].Exchange)
+	assert.Equal(t, "1h", env.Klines[0].Interval)
+	assert.True(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Equal(env.Klines[0].Time))
+}
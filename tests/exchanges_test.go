@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	"infosir/pkg/crypto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBybitClient_NormalisesKlines checks that Bybit's newest-first string lists are parsed
+// into ascending models.Kline values and that the time window is passed along.
+func TestBybitClient_NormalisesKlines(t *testing.T) {
+	utils.InitLogger()
+
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		_, _ = fmt.Fprint(w, `{"retCode":0,"retMsg":"OK","result":{"symbol":"BTCUSDT","list":[`+
+			`["1704067260000","42010","42030","42000","42025","3.5","147000"],`+
+			`["1704067200000","42000","42020","41990","42010","12.5","525000"]]}}`)
+	}))
+	defer srv.Close()
+
+	utils.GetConfig().Crypto.BybitBaseURL = srv.URL
+	utils.GetConfig().Crypto.BybitCategory = "linear"
+	utils.GetConfig().Crypto.BybitRequestLimit = 600
+
+	start := time.UnixMilli(1704067200000)
+	klines, err := crypto.NewBybitClient().FetchKlinesRange(context.Background(), "BTCUSDT", "1m", start, start.Add(time.Hour), 2)
+
+	assert.NoError(t, err)
+	assert.Contains(t, query, "interval=1&")
+	assert.Contains(t, query, "start=1704067200000")
+	assert.Contains(t, query, "end=1704067260000", "window should be capped to 'limit' candles")
+	if assert.Len(t, klines, 2) {
+		assert.Equal(t, start, klines[0].Time)
+		assert.Equal(t, "42010", klines[0].ClosePrice.String())
+		assert.Equal(t, "525000", klines[0].QuoteVolume.String())
+		assert.Equal(t, "BTCUSDT", klines[1].Symbol)
+		assert.Equal(t, models.ExchangeBybit, klines[1].Exchange)
+	}
+}
+
+// TestOKXClient_NormalisesKlines checks OKX candle parsing, ordering and symbol normalisation.
+func TestOKXClient_NormalisesKlines(t *testing.T) {
+	utils.InitLogger()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"code":"0","msg":"","data":[`+
+			`["1704070800000","42100","42200","42050","42150","100","1.5","63000","0"],`+
+			`["1704067200000","42000","42300","41900","42100","500","7.5","315000","1"]]}`)
+	}))
+	defer srv.Close()
+
+	utils.GetConfig().Crypto.OKXBaseURL = srv.URL
+	utils.GetConfig().Crypto.OKXRequestLimit = 300
+
+	klines, err := crypto.NewOKXClient().FetchKlines(context.Background(), "BTC-USDT-SWAP", "1h", 2)
+
+	assert.NoError(t, err)
+	if assert.Len(t, klines, 2) {
+		assert.Equal(t, time.UnixMilli(1704067200000), klines[0].Time)
+		assert.Equal(t, "BTCUSDT", klines[0].Symbol)
+		assert.Equal(t, "7.5", klines[0].Volume.String())
+		assert.Equal(t, "315000", klines[0].QuoteVolume.String())
+	}
+	assert.Equal(t, models.MarketFutures, klines[0].Market)
+	assert.Equal(t,
+		models.Instrument{Exchange: models.ExchangeOKX, Market: models.MarketFutures, Symbol: "BTCUSDT"},
+		crypto.InstrumentFor(models.ExchangeOKX, "BTC-USDT-SWAP"))
+}
+
+// TestOKXClient_SpotVolumes checks that spot candles take the base volume from vol: for spot, OKX
+// reports volCcy in quote currency.
+func TestOKXClient_SpotVolumes(t *testing.T) {
+	utils.InitLogger()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"code":"0","msg":"","data":[`+
+			`["1704067200000","42000","42300","41900","42100","7.5","315000","315000","1"]]}`)
+	}))
+	defer srv.Close()
+
+	utils.GetConfig().Crypto.OKXBaseURL = srv.URL
+	utils.GetConfig().Crypto.OKXRequestLimit = 300
+
+	klines, err := crypto.NewOKXClient().FetchKlines(context.Background(), "BTC-USDT", "1h", 1)
+
+	assert.NoError(t, err)
+	if assert.Len(t, klines, 1) {
+		assert.Equal(t, models.MarketSpot, klines[0].Market)
+		assert.Equal(t, "7.5", klines[0].Volume.String())
+		assert.Equal(t, "315000", klines[0].QuoteVolume.String())
+	}
+}
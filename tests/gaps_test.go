@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"infosir/cmd/handler"
+	"infosir/internal/jobs"
+	"infosir/internal/models"
+	"infosir/internal/srv"
+	"infosir/internal/utils"
+	"infosir/tests/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGapHealer_RefetchesMissingRange checks that a found gap is re-fetched from the exchange,
+// stored, and reported as healed.
+func TestGapHealer_RefetchesMissingRange(t *testing.T) {
+	utils.InitLogger()
+	cfg := utils.GetConfig()
+	cfg.Crypto.Pairs = []string{"BTCUSDT"}
+	cfg.Crypto.BybitPairs, cfg.Crypto.OKXPairs = nil, nil
+	cfg.Crypto.KlineInterval = "1m"
+	cfg.Crypto.BinanceKlinesPoint = "fapi/v1/klines"
+	cfg.GapScanWindow = 24 * time.Hour
+
+	ctx := context.Background()
+	repo := &mocks.MockKlineRepository{}
+	client := &mocks.MockBinanceClient{}
+	exchanges := srv.NewExchangeRegistry()
+	exchanges.Register(models.ExchangeBinance, client)
+
+	inst := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "BTCUSDT"}
+	gapFrom := time.Now().Truncate(time.Minute).Add(-time.Hour)
+	gap := models.Gap{Instrument: inst, From: gapFrom, To: gapFrom.Add(2 * time.Minute), Missing: 3}
+	missing := []models.Kline{
+		{Time: gapFrom, Symbol: "BTCUSDT"},
+		{Time: gapFrom.Add(time.Minute), Symbol: "BTCUSDT"},
+		{Time: gapFrom.Add(2 * time.Minute), Symbol: "BTCUSDT"},
+	}
+
+	repo.On("FindFirst", mock.Anything, inst).Return(models.Kline{Time: gapFrom.Add(-time.Hour)}, nil)
+	repo.On("FindGaps", mock.Anything, inst, gapFrom.Add(-time.Hour), mock.Anything, time.Minute).
+		Return([]models.Gap{gap}, nil)
+	client.On("FetchKlinesRange", mock.Anything, "BTCUSDT", "1m", gap.From, gap.To, int64(1000)).Return(missing, nil)
+	repo.On("BatchInsertKlines", mock.Anything, missing).Return(nil)
+
+	healer := jobs.NewGapHealer(repo, mocks.NewMemoryBackfillStore(), exchanges)
+	healer.ScanAndHeal(ctx)
+
+	status := healer.Status()
+	assert.False(t, status.Running)
+	assert.Empty(t, status.Gaps, "healed gaps should no longer be reported")
+	assert.Equal(t, 1, status.HealedGaps)
+	assert.Equal(t, int64(3), status.HealedKlines)
+	repo.AssertExpectations(t)
+	client.AssertExpectations(t)
+
+	// The status is served as JSON.
+	rec := httptest.NewRecorder()
+	handler.GapsHandler(healer).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/gaps", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body jobs.GapStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, int64(3), body.HealedKlines)
+}
+
+// TestGapHealer_ReportsGapsWithoutExchangeData checks that a gap the exchange returns no candles
+// for is reported as unhealable rather than healed, and isn't re-fetched by the next cycle.
+func TestGapHealer_ReportsGapsWithoutExchangeData(t *testing.T) {
+	utils.InitLogger()
+	cfg := utils.GetConfig()
+	cfg.Crypto.Pairs = []string{"BTCUSDT"}
+	cfg.Crypto.BybitPairs, cfg.Crypto.OKXPairs = nil, nil
+	cfg.Crypto.KlineInterval = "1m"
+	cfg.Crypto.BinanceKlinesPoint = "fapi/v1/klines"
+	cfg.GapScanWindow = 24 * time.Hour
+
+	ctx := context.Background()
+	repo := &mocks.MockKlineRepository{}
+	client := &mocks.MockBinanceClient{}
+	exchanges := srv.NewExchangeRegistry()
+	exchanges.Register(models.ExchangeBinance, client)
+
+	inst := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "BTCUSDT"}
+	gapFrom := time.Now().Truncate(time.Minute).Add(-time.Hour)
+	gap := models.Gap{Instrument: inst, From: gapFrom, To: gapFrom.Add(2 * time.Minute), Missing: 3}
+
+	repo.On("FindFirst", mock.Anything, inst).Return(models.Kline{Time: gapFrom.Add(-time.Hour)}, nil)
+	repo.On("FindGaps", mock.Anything, inst, gapFrom.Add(-time.Hour), mock.Anything, time.Minute).
+		Return([]models.Gap{gap}, nil)
+	client.On("FetchKlinesRange", mock.Anything, "BTCUSDT", "1m", mock.Anything, gap.To, int64(1000)).
+		Return([]models.Kline{}, nil)
+
+	healer := jobs.NewGapHealer(repo, mocks.NewMemoryBackfillStore(), exchanges)
+	healer.ScanAndHeal(ctx)
+
+	status := healer.Status()
+	assert.Zero(t, status.HealedGaps)
+	assert.Equal(t, 1, status.UnhealableGaps)
+	assert.Empty(t, status.Gaps)
+	assert.Equal(t, []models.Gap{gap}, status.Unhealable)
+	fetches := len(client.Calls)
+	require.NotZero(t, fetches)
+
+	healer.ScanAndHeal(ctx)
+
+	status = healer.Status()
+	assert.Equal(t, 1, status.UnhealableGaps, "the gap is still reported")
+	assert.Len(t, client.Calls, fetches, "the gap must not be re-fetched")
+	repo.AssertNotCalled(t, "BatchInsertKlines", mock.Anything, mock.Anything)
+}
+
+// TestGapHealer_SkipsInstrumentsBeingBackfilled checks that an instrument with an unfinished backfill
+// isn't scanned: the range the backfill hasn't reached yet would otherwise be fetched twice.
+func TestGapHealer_SkipsInstrumentsBeingBackfilled(t *testing.T) {
+	utils.InitLogger()
+	cfg := utils.GetConfig()
+	cfg.Crypto.Pairs = []string{"BTCUSDT"}
+	cfg.Crypto.BybitPairs, cfg.Crypto.OKXPairs = nil, nil
+	cfg.Crypto.KlineInterval = "1m"
+	cfg.GapScanWindow = 24 * time.Hour
+
+	ctx := context.Background()
+	repo := &mocks.MockKlineRepository{}
+	client := &mocks.MockBinanceClient{}
+	exchanges := srv.NewExchangeRegistry()
+	exchanges.Register(models.ExchangeBinance, client)
+
+	store := mocks.NewMemoryBackfillStore()
+	job, err := store.Create(ctx, models.BackfillJob{
+		Exchange: models.ExchangeBinance,
+		Pair:     "BTCUSDT",
+		Interval: "1m",
+		Start:    time.Now().Add(-48 * time.Hour),
+		End:      time.Now(),
+		Status:   models.BackfillPaused,
+	})
+	require.NoError(t, err)
+
+	healer := jobs.NewGapHealer(repo, store, exchanges)
+	healer.ScanAndHeal(ctx)
+
+	assert.Empty(t, healer.Status().Gaps)
+	repo.AssertNotCalled(t, "FindGaps", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	client.AssertNotCalled(t, "FetchKlinesRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Once the backfill is done, the instrument is scanned again.
+	require.NoError(t, store.SetStatus(ctx, job.ID, models.BackfillDone, ""))
+	inst := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "BTCUSDT"}
+	first := time.Now().Truncate(time.Minute).Add(-time.Hour)
+	repo.On("FindFirst", mock.Anything, inst).Return(models.Kline{Time: first}, nil)
+	repo.On("FindGaps", mock.Anything, inst, first, mock.Anything, time.Minute).Return([]models.Gap(nil), nil)
+
+	healer.ScanAndHeal(ctx)
+
+	repo.AssertExpectations(t)
+}
@@ -15,6 +15,7 @@ import (
 	"infosir/internal/utils"
 
 	_ "github.com/lib/pq" // example: if we do a direct DB test
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -46,17 +47,21 @@ func TestIntegration_DatabaseInsert(t *testing.T) {
 	}
 	// 5. Insert a kline
 	testKline := models.Kline{
+		Exchange:            models.ExchangeBinance,
+		Market:              models.MarketFutures,
 		Symbol:              "TESTPAIR",
 		Time:                openTime,
-		OpenPrice:           123.45,
-		HighPrice:           130.00,
-		LowPrice:            120.11,
-		ClosePrice:          128.00,
-		Volume:              123.456,
-		QuoteVolume:         999.999,
+		CloseTime:           models.CloseTimeFor(openTime, time.Minute),
+		IsClosed:            true,
+		OpenPrice:           decimal.RequireFromString("123.45"),
+		HighPrice:           decimal.RequireFromString("130.00"),
+		LowPrice:            decimal.RequireFromString("120.11"),
+		ClosePrice:          decimal.RequireFromString("128.00"),
+		Volume:              decimal.RequireFromString("123.456"),
+		QuoteVolume:         decimal.RequireFromString("999.999"),
 		Trades:              456,
-		TakerBuyBaseVolume:  50.0,
-		TakerBuyQuoteVolume: 60.0,
+		TakerBuyBaseVolume:  decimal.RequireFromString("50.0"),
+		TakerBuyQuoteVolume: decimal.RequireFromString("60.0"),
 	}
 
 	ctx := context.Background()
@@ -64,12 +69,102 @@ func TestIntegration_DatabaseInsert(t *testing.T) {
 	assert.NoError(t, err, "InsertKline should succeed")
 
 	// 6. Retrieve the last kline for "TESTPAIR"
-	retrieved, err := kRepo.FindLast(ctx, "testpair") // note the lowercase, if you store symbol in lower
+	retrieved, err := kRepo.FindLast(ctx, testKline.Instrument())
 	assert.NoError(t, err, "FindLast should succeed")
-	assert.Equal(t, testKline.ClosePrice, retrieved.ClosePrice, "ClosePrice mismatch")
+	assert.True(t, testKline.ClosePrice.Equal(retrieved.ClosePrice), "ClosePrice mismatch")
 	assert.Equal(t, testKline.Trades, retrieved.Trades, "Trades mismatch")
 }
 
+// TestIntegration_RangeQueries inserts a few consecutive klines and reads them back through the
+// range, first, count and streaming APIs.
+func TestIntegration_RangeQueries(t *testing.T) {
+	if err := config.LoadConfig(); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	utils.InitLogger()
+
+	dbPool, err := db.InitDatabase()
+	if err != nil {
+		t.Fatalf("Cannot init DB: %v", err)
+	}
+	defer dbPool.Close()
+
+	kRepo := repository.NewKlineRepository(dbPool)
+	ctx := context.Background()
+
+	inst := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "RANGEPAIR"}
+	start := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	klines := make([]models.Kline, 0, 5)
+	for i := 0; i < 5; i++ {
+		openTime := start.Add(time.Duration(i) * time.Minute)
+		klines = append(klines, models.Kline{
+			Time:                openTime,
+			CloseTime:           models.CloseTimeFor(openTime, time.Minute),
+			IsClosed:            true,
+			Exchange:            inst.Exchange,
+			Market:              inst.Market,
+			Symbol:              inst.Symbol,
+			OpenPrice:           decimal.NewFromInt(int64(100 + i)),
+			HighPrice:           decimal.NewFromInt(int64(101 + i)),
+			LowPrice:            decimal.NewFromInt(int64(99 + i)),
+			ClosePrice:          decimal.NewFromInt(int64(100 + i)),
+			Volume:              decimal.NewFromInt(1),
+			QuoteVolume:         decimal.NewFromInt(100),
+			Trades:              1,
+			TakerBuyBaseVolume:  decimal.NewFromInt(1),
+			TakerBuyQuoteVolume: decimal.NewFromInt(100),
+		})
+	}
+	assert.NoError(t, kRepo.BatchInsertKlines(ctx, klines))
+
+	end := start.Add(4 * time.Minute)
+	ranged, err := kRepo.FindRange(ctx, inst, start.Add(time.Minute), end, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, ranged, 2) {
+		assert.True(t, ranged[0].Time.Equal(start.Add(time.Minute)), "range should be ascending")
+	}
+
+	first, err := kRepo.FindFirst(ctx, inst)
+	assert.NoError(t, err)
+	assert.True(t, first.Time.Equal(start))
+
+	n, err := kRepo.Count(ctx, inst, start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	var streamed int
+	assert.NoError(t, kRepo.StreamRange(ctx, inst, start, end, func(models.Kline) error {
+		streamed++
+		return nil
+	}))
+	assert.Equal(t, 5, streamed)
+
+	aggregated, err := kRepo.FindAggregated(ctx, inst, models.Interval5m, start, end, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, aggregated, 1, "five 1m klines make one 5m bucket") {
+		assert.True(t, aggregated[0].OpenPrice.Equal(decimal.NewFromInt(100)))
+		assert.True(t, aggregated[0].ClosePrice.Equal(decimal.NewFromInt(104)))
+		assert.True(t, aggregated[0].Volume.Equal(decimal.NewFromInt(5)))
+	}
+
+	// Stored are 00:00..00:04; scanning 23:58..00:07 finds the leading and the trailing hole.
+	gaps, err := kRepo.FindGaps(ctx, inst, start.Add(-2*time.Minute), start.Add(7*time.Minute), time.Minute)
+	assert.NoError(t, err)
+	if assert.Len(t, gaps, 2) {
+		assert.True(t, gaps[0].From.Equal(start.Add(-2*time.Minute)))
+		assert.Equal(t, int64(2), gaps[0].Missing)
+		assert.True(t, gaps[1].From.Equal(start.Add(5*time.Minute)))
+		assert.True(t, gaps[1].To.Equal(start.Add(7*time.Minute)))
+	}
+
+	instruments, err := kRepo.FindInstruments(ctx, inst.Exchange)
+	assert.NoError(t, err)
+	assert.Contains(t, instruments, inst)
+
+	_, err = kRepo.FindLast(ctx, models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "NOSUCHPAIR"})
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
 // TestIntegration_Connection ensures DB migrations are done properly
 func TestIntegration_Connection(t *testing.T) {
 	// Possibly you want to check that the table "futures_klines" is created, etc.
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"infosir/cmd/handler"
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	natsinfosir "infosir/pkg/nats"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLatestKlines is a CurrentKlineReader backed by a map keyed like the bucket.
+type fakeLatestKlines map[string]models.Kline
+
+func (f fakeLatestKlines) Get(_ context.Context, exchange, symbol, interval string) (models.Kline, error) {
+	k, ok := f[natsinfosir.LatestKlineKey(exchange, symbol, interval)]
+	if !ok {
+		return models.Kline{}, natsinfosir.ErrNoLatestKline
+	}
+	return k, nil
+}
+
+// TestLatestKlineKey_Format checks the bucket keys and watch filters.
+func TestLatestKlineKey_Format(t *testing.T) {
+	assert.Equal(t, "binance.BTCUSDT.1m", natsinfosir.LatestKlineKey("binance", "BTCUSDT", "1m"))
+	assert.Equal(t, "okx._.1h", natsinfosir.LatestKlineKey("okx", "", "1h"))
+	assert.Equal(t, "binance.*.1m", natsinfosir.LatestKlineFilter("binance", "", "1m"))
+	assert.Equal(t, "*.*.*", natsinfosir.LatestKlineFilter("", "", ""))
+}
+
+// TestNewestPerSeries_KeepsLatestCandle checks that only the newest candle of every series is
+// written, and that a closed candle isn't replaced by a re-delivered open state of itself.
+func TestNewestPerSeries_KeepsLatestCandle(t *testing.T) {
+	open := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kline := func(symbol string, at time.Time, closePrice int64, closed bool) models.Kline {
+		return models.Kline{
+			Time:       at,
+			Exchange:   models.ExchangeBinance,
+			Market:     models.MarketFutures,
+			Symbol:     symbol,
+			Interval:   "1m",
+			ClosePrice: decimal.NewFromInt(closePrice),
+			IsClosed:   closed,
+		}
+	}
+
+	newest := natsinfosir.NewestPerSeries([]models.Kline{
+		kline("BTCUSDT", open.Add(time.Minute), 1, false),
+		kline("ETHUSDT", open, 10, true),
+		kline("BTCUSDT", open, 2, true),
+		kline("ETHUSDT", open, 11, false),
+		kline("BTCUSDT", open.Add(time.Minute), 3, false),
+	})
+
+	if assert.Len(t, newest, 2) {
+		assert.Equal(t, "BTCUSDT", newest[0].Symbol)
+		assert.True(t, decimal.NewFromInt(3).Equal(newest[0].ClosePrice), "later candle wins, latest state of it")
+		assert.Equal(t, "ETHUSDT", newest[1].Symbol)
+		assert.True(t, decimal.NewFromInt(10).Equal(newest[1].ClosePrice), "closed candle is final")
+	}
+}
+
+// TestCurrentKlineHandler serves the bucket entry of a series and 404 for unknown ones.
+func TestCurrentKlineHandler(t *testing.T) {
+	utils.InitLogger()
+	stored := models.Kline{
+		Time:       time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Exchange:   models.ExchangeBinance,
+		Market:     models.MarketFutures,
+		Symbol:     "BTCUSDT",
+		Interval:   "5m",
+		ClosePrice: decimal.NewFromInt(42),
+	}
+	latest := fakeLatestKlines{"binance.BTCUSDT.5m": stored}
+	h := handler.CurrentKlineHandler(latest, utils.Logger)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/klines/current?symbol=btcusdt&interval=5m", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Data models.Kline `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.True(t, stored.ClosePrice.Equal(body.Data.ClosePrice))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/klines/current?symbol=ETHUSDT&interval=5m", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/klines/current?market=futures&symbol=BTCUSDT&interval=5m", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/klines/current?market=spot&symbol=BTCUSDT&interval=5m", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "the stored candle is of another market")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/klines/current?symbol=BTCUSDT&interval=7m", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,108 @@
+package mocks
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"infosir/internal/db/repository"
+	"infosir/internal/models"
+)
+
+// MemoryBackfillStore is an in-memory BackfillStore. Unlike a call-recording mock it keeps
+// state, which lets tests follow a job through its whole lifecycle, including restarts.
+type MemoryBackfillStore struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]models.BackfillJob
+}
+
+// NewMemoryBackfillStore constructs an empty store.
+func NewMemoryBackfillStore() *MemoryBackfillStore {
+	return &MemoryBackfillStore{jobs: make(map[int64]models.BackfillJob)}
+}
+
+// Create stores a new job with the next id.
+func (s *MemoryBackfillStore) Create(_ context.Context, job models.BackfillJob) (models.BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	job.ID = s.nextID
+	job.CreatedAt, job.UpdatedAt = time.Now(), time.Now()
+	s.jobs[job.ID] = job
+	return job, nil
+}
+
+// Get returns the job or repository.ErrJobNotFound.
+func (s *MemoryBackfillStore) Get(_ context.Context, id int64) (models.BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return models.BackfillJob{}, repository.ErrJobNotFound
+	}
+	return job, nil
+}
+
+// List returns the jobs in one of the statuses (all if none given), newest first.
+func (s *MemoryBackfillStore) List(_ context.Context, statuses ...models.BackfillStatus) ([]models.BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []models.BackfillJob
+	for _, job := range s.jobs {
+		if len(statuses) == 0 || containsStatus(statuses, job.Status) {
+			list = append(list, job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+// SaveCheckpoint records the cursor and fetched count.
+func (s *MemoryBackfillStore) SaveCheckpoint(_ context.Context, id int64, cursor time.Time, fetched int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.jobs[id]
+	job.Cursor, job.Fetched = cursor, fetched
+	s.jobs[id] = job
+	return nil
+}
+
+// SetStatus records the status and error message.
+func (s *MemoryBackfillStore) SetStatus(_ context.Context, id int64, status models.BackfillStatus, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return repository.ErrJobNotFound
+	}
+	job.Status, job.Error = status, errMsg
+	s.jobs[id] = job
+	return nil
+}
+
+// Put stores a job as is, e.g. to simulate state left behind by a previous process.
+func (s *MemoryBackfillStore) Put(job models.BackfillJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.ID > s.nextID {
+		s.nextID = job.ID
+	}
+	s.jobs[job.ID] = job
+}
+
+func containsStatus(statuses []models.BackfillStatus, status models.BackfillStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
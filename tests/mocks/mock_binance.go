@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"infosir/internal/models"
 
@@ -25,3 +26,16 @@ func (m *MockBinanceClient) FetchKlines(
 	klines, _ := args.Get(0).([]models.Kline)
 	return klines, args.Error(1)
 }
+
+// FetchKlinesRange is the mock implementation for fetching klines within a time range.
+func (m *MockBinanceClient) FetchKlinesRange(
+	ctx context.Context,
+	pair, interval string,
+	start, end time.Time,
+	limit int64,
+) ([]models.Kline, error) {
+
+	args := m.Called(ctx, pair, interval, start, end, limit)
+	klines, _ := args.Get(0).([]models.Kline)
+	return klines, args.Error(1)
+}
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"infosir/internal/models"
 	"infosir/internal/srv"
@@ -17,15 +18,31 @@ type MockInfoSirService struct {
 	mock.Mock
 }
 
-// GetKlines mocks the retrieval of klines from the underlying binance-like client.
+// GetKlines mocks the retrieval of klines from the underlying exchange client.
 func (m *MockInfoSirService) GetKlines(
 	ctx context.Context,
+	exchange string,
 	pair string,
 	interval string,
 	limit int64,
 ) ([]models.Kline, error) {
 
-	args := m.Called(ctx, pair, interval, limit)
+	args := m.Called(ctx, exchange, pair, interval, limit)
+	klines, _ := args.Get(0).([]models.Kline)
+	return klines, args.Error(1)
+}
+
+// GetKlinesRange mocks the retrieval of a time window of klines from the underlying exchange client.
+func (m *MockInfoSirService) GetKlinesRange(
+	ctx context.Context,
+	exchange string,
+	pair string,
+	interval string,
+	start, end time.Time,
+	limit int64,
+) ([]models.Kline, error) {
+
+	args := m.Called(ctx, exchange, pair, interval, start, end, limit)
 	klines, _ := args.Get(0).([]models.Kline)
 	return klines, args.Error(1)
 }
@@ -34,7 +51,8 @@ func (m *MockInfoSirService) GetKlines(
 func (m *MockInfoSirService) PublishKlinesJS(
 	ctx context.Context,
 	klines []models.Kline,
-) error {
+) (models.PublishAck, error) {
 	args := m.Called(ctx, klines)
-	return args.Error(0)
+	ack, _ := args.Get(0).(models.PublishAck)
+	return ack, args.Error(1)
 }
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"infosir/internal/models"
 
@@ -25,9 +26,91 @@ func (m *MockKlineRepository) BatchInsertKlines(ctx context.Context, klines []mo
 	return args.Error(0)
 }
 
-// FindLast mocks retrieving the most recent Kline for the given symbol.
-func (m *MockKlineRepository) FindLast(ctx context.Context, symbol string) (models.Kline, error) {
-	args := m.Called(ctx, symbol)
+// StoreKlinesTx mocks storing klines in a single transaction.
+func (m *MockKlineRepository) StoreKlinesTx(ctx context.Context, klines []models.Kline) error {
+	args := m.Called(ctx, klines)
+	return args.Error(0)
+}
+
+// FindLast mocks retrieving the most recent Kline for the given instrument.
+func (m *MockKlineRepository) FindLast(ctx context.Context, inst models.Instrument) (models.Kline, error) {
+	args := m.Called(ctx, inst)
+	k, _ := args.Get(0).(models.Kline)
+	return k, args.Error(1)
+}
+
+// FindFirst mocks retrieving the oldest Kline for the given instrument.
+func (m *MockKlineRepository) FindFirst(ctx context.Context, inst models.Instrument) (models.Kline, error) {
+	args := m.Called(ctx, inst)
 	k, _ := args.Get(0).(models.Kline)
 	return k, args.Error(1)
 }
+
+// FindRange mocks retrieving the klines of an instrument within [from, to].
+func (m *MockKlineRepository) FindRange(
+	ctx context.Context,
+	inst models.Instrument,
+	from, to time.Time,
+	limit int,
+) ([]models.Kline, error) {
+	args := m.Called(ctx, inst, from, to, limit)
+	klines, _ := args.Get(0).([]models.Kline)
+	return klines, args.Error(1)
+}
+
+// StreamRange mocks streaming the klines of an instrument within [from, to]: it feeds the klines
+// configured as the first return value to fn and then returns the configured error.
+func (m *MockKlineRepository) StreamRange(
+	ctx context.Context,
+	inst models.Instrument,
+	from, to time.Time,
+	fn func(models.Kline) error,
+) error {
+	args := m.Called(ctx, inst, from, to, fn)
+	klines, _ := args.Get(0).([]models.Kline)
+	for _, k := range klines {
+		if err := fn(k); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+// Count mocks counting the klines of an instrument within [from, to].
+func (m *MockKlineRepository) Count(ctx context.Context, inst models.Instrument, from, to time.Time) (int64, error) {
+	args := m.Called(ctx, inst, from, to)
+	n, _ := args.Get(0).(int64)
+	return n, args.Error(1)
+}
+
+// FindAggregated mocks retrieving klines of a coarser interval for an instrument within [from, to].
+func (m *MockKlineRepository) FindAggregated(
+	ctx context.Context,
+	inst models.Instrument,
+	interval models.Interval,
+	from, to time.Time,
+	limit int,
+) ([]models.Kline, error) {
+	args := m.Called(ctx, inst, interval, from, to, limit)
+	klines, _ := args.Get(0).([]models.Kline)
+	return klines, args.Error(1)
+}
+
+// FindGaps mocks listing the missing candle ranges of an instrument within [from, to].
+func (m *MockKlineRepository) FindGaps(
+	ctx context.Context,
+	inst models.Instrument,
+	from, to time.Time,
+	step time.Duration,
+) ([]models.Gap, error) {
+	args := m.Called(ctx, inst, from, to, step)
+	gaps, _ := args.Get(0).([]models.Gap)
+	return gaps, args.Error(1)
+}
+
+// FindInstruments mocks listing the instruments with stored klines.
+func (m *MockKlineRepository) FindInstruments(ctx context.Context, exchange string) ([]models.Instrument, error) {
+	args := m.Called(ctx, exchange)
+	instruments, _ := args.Get(0).([]models.Instrument)
+	return instruments, args.Error(1)
+}
@@ -14,7 +14,8 @@ type MockNatsClient struct {
 }
 
 // PublishKlines mocks the method to publish klines to a JetStream subject.
-func (m *MockNatsClient) PublishKlines(ctx context.Context, klines []models.Kline) error {
+func (m *MockNatsClient) PublishKlines(ctx context.Context, klines []models.Kline) (models.PublishAck, error) {
 	args := m.Called(ctx, klines)
-	return args.Error(0)
+	ack, _ := args.Get(0).(models.PublishAck)
+	return ack, args.Error(1)
 }
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"infosir/cmd/handler"
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	"infosir/tests/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// postOrchestrator sends the JSON body to the orchestrator handler and returns the recorder.
+func postOrchestrator(service *mocks.MockInfoSirService, body string) *httptest.ResponseRecorder {
+	utils.InitLogger()
+	cfg := utils.GetConfig()
+	cfg.Crypto.Pairs = []string{"BTCUSDT"}
+	cfg.Crypto.BinanceKlinesPoint = "fapi/v1/klines"
+
+	rec := httptest.NewRecorder()
+	handler.OrchestratorHandler(service, utils.Logger).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orchestrator/fetch", strings.NewReader(body)))
+	return rec
+}
+
+// TestOrchestratorHandler_ReturnsKlinesAndAck checks that the klines limit is capped at the
+// exchange maximum and that the response carries the klines and the publish acknowledgement.
+func TestOrchestratorHandler_ReturnsKlinesAndAck(t *testing.T) {
+	service := &mocks.MockInfoSirService{}
+	klines := []models.Kline{{Symbol: "BTCUSDT", Time: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}}
+
+	service.On("GetKlines", mock.Anything, models.ExchangeBinance, "BTCUSDT", "1m", int64(1500)).Return(klines, nil)
+	service.On("PublishKlinesJS", mock.Anything, klines).
+		Return(models.PublishAck{Stream: "infosir_kline_stream", Sequence: 42}, nil)
+
+	rec := postOrchestrator(service, `{"pair":"BTCUSDT","time":"1m","klines":100000}`)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"seq":42`)
+	assert.Contains(t, rec.Body.String(), `"stream":"infosir_kline_stream"`)
+	assert.Contains(t, rec.Body.String(), `"symbol":"BTCUSDT"`)
+	service.AssertExpectations(t)
+}
+
+// TestOrchestratorHandler_FetchesWindow checks that start/end route to a range fetch.
+func TestOrchestratorHandler_FetchesWindow(t *testing.T) {
+	service := &mocks.MockInfoSirService{}
+	start := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	service.On("GetKlinesRange", mock.Anything, models.ExchangeBinance, "BTCUSDT", "1m",
+		mock.MatchedBy(start.Equal), mock.MatchedBy(end.Equal), int64(1500)).Return([]models.Kline{}, nil)
+	service.On("PublishKlinesJS", mock.Anything, []models.Kline{}).Return(models.PublishAck{}, nil)
+
+	rec := postOrchestrator(service,
+		`{"pair":"BTCUSDT","time":"1m","start":"2024-02-01T00:00:00Z","end":"2024-02-01T01:00:00Z"}`)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	service.AssertExpectations(t)
+}
+
+// TestOrchestratorHandler_RejectsInvalidRequests checks pair, interval, exchange and window validation.
+func TestOrchestratorHandler_RejectsInvalidRequests(t *testing.T) {
+	service := &mocks.MockInfoSirService{}
+
+	for _, body := range []string{
+		`{"pair":"DOGEUSDT","time":"1m","klines":10}`,                   // pair not configured
+		`{"pair":"BTCUSDT","time":"7m","klines":10}`,                    // unsupported interval
+		`{"pair":"BTCUSDT","time":"1m"}`,                                // no limit and no window
+		`{"exchange":"kraken","pair":"BTCUSDT","time":"1m","klines":1}`, // unknown exchange
+		`{"pair":"BTCUSDT","time":"1m","start":"2024-02-02T00:00:00Z","end":"2024-02-01T00:00:00Z"}`,
+		`not json`,
+	} {
+		rec := postOrchestrator(service, body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		assert.Contains(t, rec.Body.String(), `"invalid_argument"`, body)
+	}
+	service.AssertNotCalled(t, "GetKlines")
+	service.AssertNotCalled(t, "GetKlinesRange")
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"infosir/internal/jobs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRunPairs_BoundsConcurrencyAndReports checks that no more than 'concurrency' tasks run at
+// once and that successes, failures and latencies are reported.
+func TestRunPairs_BoundsConcurrencyAndReports(t *testing.T) {
+	tasks := make([]jobs.PairTask, 20)
+	for i := range tasks {
+		tasks[i] = jobs.PairTask{Exchange: "binance", Pair: string(rune('A' + i))}
+	}
+
+	var running, peak atomic.Int32
+	report := jobs.RunPairs(context.Background(), "test", 4, tasks, func(ctx context.Context, task jobs.PairTask) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if task.Pair == "C" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	assert.LessOrEqual(t, peak.Load(), int32(4))
+	assert.Equal(t, 19, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, "boom", report.Failures["binance/C"])
+	assert.GreaterOrEqual(t, report.MaxLatency, 10*time.Millisecond)
+	assert.Less(t, report.Duration, 20*10*time.Millisecond, "tasks should run in parallel")
+}
+
+// TestRunPairs_CancelledCycleSkipsRemaining checks that a cancelled cycle stops handing out work,
+// and that the pairs it never started count neither as failed nor in the average latency.
+func TestRunPairs_CancelledCycleSkipsRemaining(t *testing.T) {
+	tasks := []jobs.PairTask{{Pair: "A"}, {Pair: "B"}, {Pair: "C"}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls atomic.Int32
+	report := jobs.RunPairs(ctx, "test", 1, tasks, func(ctx context.Context, task jobs.PairTask) error {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		return nil
+	})
+
+	assert.LessOrEqual(t, calls.Load(), int32(2))
+	assert.Equal(t, int(calls.Load()), report.Succeeded)
+	assert.Zero(t, report.Failed)
+	assert.Equal(t, 3, report.Succeeded+report.Skipped)
+	assert.GreaterOrEqual(t, report.Skipped, 1)
+	assert.GreaterOrEqual(t, report.AvgLatency, 10*time.Millisecond, "skipped pairs don't dilute the average")
+}
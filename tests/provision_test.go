@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	natsinfosir "infosir/pkg/nats"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReconcileStreamConfig_UpdatesInPlace checks that mutable settings follow the config while
+// earlier subjects are kept.
+func TestReconcileStreamConfig_UpdatesInPlace(t *testing.T) {
+	current := nats.StreamConfig{
+		Name:       "infosir_kline_stream",
+		Subjects:   []string{"infosir_kline"},
+		Storage:    nats.FileStorage,
+		MaxBytes:   -1,
+		Replicas:   1,
+		Duplicates: 2 * time.Minute,
+	}
+	desired := current
+	desired.Subjects = []string{"infosir.kline.>"}
+	desired.MaxAge = 72 * time.Hour
+	desired.Duplicates = 2 * time.Hour
+
+	updated, changed, err := natsinfosir.ReconcileStreamConfig(current, desired)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"infosir_kline", "infosir.kline.>"}, updated.Subjects)
+	assert.Equal(t, 72*time.Hour, updated.MaxAge)
+	assert.Equal(t, 2*time.Hour, updated.Duplicates)
+	assert.Equal(t, []string{"infosir_kline"}, current.Subjects, "the current config is not modified")
+
+	_, changed, err = natsinfosir.ReconcileStreamConfig(updated, desired)
+	require.NoError(t, err)
+	assert.False(t, changed, "reconciling twice is a no-op")
+}
+
+// TestReconcileStreamConfig_RejectsIncompatible checks that storage and retention changes fail.
+func TestReconcileStreamConfig_RejectsIncompatible(t *testing.T) {
+	current := nats.StreamConfig{Name: "infosir_kline_stream", Storage: nats.FileStorage}
+
+	desired := current
+	desired.Storage = nats.MemoryStorage
+	_, _, err := natsinfosir.ReconcileStreamConfig(current, desired)
+	assert.ErrorIs(t, err, natsinfosir.ErrIncompatibleConfig)
+
+	desired = current
+	desired.Retention = nats.WorkQueuePolicy
+	_, _, err = natsinfosir.ReconcileStreamConfig(current, desired)
+	assert.ErrorIs(t, err, natsinfosir.ErrIncompatibleConfig)
+}
+
+// TestReconcileConsumerConfig checks consumer updates and the refusal to take over a push consumer.
+func TestReconcileConsumerConfig(t *testing.T) {
+	desired := nats.ConsumerConfig{
+		Durable:       "infosir_kline_consumer",
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       30 * time.Second,
+		MaxDeliver:    5,
+		MaxAckPending: 1000,
+		FilterSubject: "infosir.kline.*.*.1m",
+	}
+
+	current := desired
+	current.MaxDeliver = 3
+	current.FilterSubject = "infosir_kline"
+	updated, changed, err := natsinfosir.ReconcileConsumerConfig(current, desired)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, desired, updated)
+
+	push := desired
+	push.DeliverSubject = "_INBOX.abc"
+	_, _, err = natsinfosir.ReconcileConsumerConfig(push, desired)
+	assert.ErrorIs(t, err, natsinfosir.ErrIncompatibleConfig)
+}
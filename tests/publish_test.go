@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"infosir/internal/models"
+	natsinfosir "infosir/pkg/nats"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestKlineMsgID_IsDeterministic checks that re-published klines get the same message ID, while
+// other series, open times and in-progress updates get their own.
+func TestKlineMsgID_IsDeterministic(t *testing.T) {
+	k := models.Kline{
+		Time:       time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Exchange:   models.ExchangeBinance,
+		Market:     models.MarketFutures,
+		Symbol:     "BTCUSDT",
+		Interval:   "1m",
+		ClosePrice: decimal.NewFromInt(100),
+		IsClosed:   true,
+	}
+	assert.Equal(t, "binance.futures.BTCUSDT.1m.1709294400000", natsinfosir.KlineMsgID(k))
+
+	refetched := k
+	refetched.ClosePrice = decimal.RequireFromString("100.0")
+	assert.Equal(t, natsinfosir.KlineMsgID(k), natsinfosir.KlineMsgID(refetched), "closed candles are keyed by open time only")
+
+	other := k
+	other.Interval = "5m"
+	assert.NotEqual(t, natsinfosir.KlineMsgID(k), natsinfosir.KlineMsgID(other))
+	other = k
+	other.Time = k.Time.Add(time.Minute)
+	assert.NotEqual(t, natsinfosir.KlineMsgID(k), natsinfosir.KlineMsgID(other))
+
+	open := k
+	open.IsClosed = false
+	update := open
+	update.ClosePrice = decimal.NewFromInt(101)
+	assert.Equal(t, natsinfosir.KlineMsgID(open), natsinfosir.KlineMsgID(open))
+	assert.NotEqual(t, natsinfosir.KlineMsgID(open), natsinfosir.KlineMsgID(update), "updates of an open candle pass")
+	assert.NotEqual(t, natsinfosir.KlineMsgID(k), natsinfosir.KlineMsgID(open), "the closed candle passes after open ones")
+}
+
+// TestKlineSubject_Hierarchy checks the subject layout and that filter subjects match it.
+func TestKlineSubject_Hierarchy(t *testing.T) {
+	k := models.Kline{Exchange: models.ExchangeOKX, Symbol: "BTC-USDT", Interval: "1h"}
+	assert.Equal(t, "infosir.kline.okx.BTC-USDT.1h", natsinfosir.KlineSubject("infosir.kline", k))
+
+	k.Symbol = "odd.sym*"
+	k.Interval = ""
+	assert.Equal(t, "infosir.kline.okx.odd_sym_._", natsinfosir.KlineSubject("infosir.kline", k),
+		"every field is exactly one token")
+
+	assert.Equal(t, "infosir.kline.*.BTCUSDT.*", natsinfosir.KlineFilterSubject("infosir.kline", "", "BTCUSDT", ""))
+	assert.Equal(t, "infosir.kline.>", natsinfosir.StreamSubject("infosir.kline"))
+}
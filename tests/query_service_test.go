@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"infosir/cmd/handler"
+	"infosir/internal/db/repository"
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	"infosir/tests/mocks"
+
+	"github.com/nats-io/nats.go/micro"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRequest is a micro.Request recording the reply instead of sending it.
+type fakeRequest struct {
+	data []byte
+
+	reply     []byte
+	errCode   string
+	errDesc   string
+	responded bool
+}
+
+func (r *fakeRequest) Respond(data []byte, _ ...micro.RespondOpt) error {
+	r.reply, r.responded = data, true
+	return nil
+}
+
+func (r *fakeRequest) RespondJSON(v any, _ ...micro.RespondOpt) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.Respond(data)
+}
+
+func (r *fakeRequest) Error(code, description string, data []byte, _ ...micro.RespondOpt) error {
+	r.errCode, r.errDesc = code, description
+	return r.Respond(data)
+}
+
+func (r *fakeRequest) Data() []byte           { return r.data }
+func (r *fakeRequest) Headers() micro.Headers { return micro.Headers{} }
+func (r *fakeRequest) Subject() string        { return "kline.test" }
+func (r *fakeRequest) Reply() string          { return "_INBOX.test" }
+
+// TestKlineQueryService_Query checks paging through kline.query.
+func TestKlineQueryService_Query(t *testing.T) {
+	utils.InitLogger()
+	repo := &mocks.MockKlineRepository{}
+	endpoint := handler.KlineQueryEndpoint(context.Background(), repo, utils.Logger)
+
+	inst := models.Instrument{Exchange: models.ExchangeOKX, Market: models.MarketSpot, Symbol: "BTCUSDT"}
+	start := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	klines := []models.Kline{{Time: start, Symbol: "BTCUSDT"}, {Time: start.Add(time.Hour), Symbol: "BTCUSDT"}}
+	repo.On("FindAggregated", mock.Anything, inst, models.Interval1h,
+		mock.MatchedBy(func(from time.Time) bool { return from.Equal(start) }),
+		mock.Anything, 2).Return(klines, nil)
+
+	req := &fakeRequest{data: []byte(`{"exchange":"okx","market":"spot","symbol":"btc-usdt","interval":"1h","from":"2024-02-01T00:00:00Z","limit":1}`)}
+	endpoint.Handle(req)
+
+	require.True(t, req.responded)
+	assert.Empty(t, req.errCode)
+	var page struct {
+		Data       []models.Kline `json:"data"`
+		NextCursor string         `json:"next_cursor"`
+	}
+	require.NoError(t, json.Unmarshal(req.reply, &page))
+	assert.Len(t, page.Data, 1)
+	assert.NotEmpty(t, page.NextCursor)
+}
+
+// TestKlineQueryService_Errors checks the error code header values and error bodies.
+func TestKlineQueryService_Errors(t *testing.T) {
+	utils.InitLogger()
+	repo := &mocks.MockKlineRepository{}
+	ctx := context.Background()
+
+	inst := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "ETHUSDT"}
+	repo.On("FindLast", mock.Anything, inst).Return(models.Kline{}, repository.ErrNotFound)
+
+	for _, tc := range []struct {
+		name     string
+		endpoint micro.Handler
+		data     string
+		code     string
+		errCode  string
+	}{
+		{"bad json", handler.KlineQueryEndpoint(ctx, repo, utils.Logger), `{"symbol":`, "400", "invalid_argument"},
+		{"missing symbol", handler.KlineQueryEndpoint(ctx, repo, utils.Logger), `{}`, "400", "invalid_argument"},
+		{"bad interval", handler.KlineQueryEndpoint(ctx, repo, utils.Logger), `{"symbol":"BTCUSDT","interval":"7m"}`, "400", "invalid_argument"},
+		{"unknown series", handler.KlineLatestEndpoint(ctx, repo, utils.Logger), `{"symbol":"ETHUSDT"}`, "404", "not_found"},
+		{"unknown exchange", handler.KlineSymbolsEndpoint(ctx, repo, utils.Logger), `{"exchange":"kraken"}`, "400", "invalid_argument"},
+	} {
+		req := &fakeRequest{data: []byte(tc.data)}
+		tc.endpoint.Handle(req)
+
+		assert.Equal(t, tc.code, req.errCode, tc.name)
+		assert.NotEmpty(t, req.errDesc, tc.name)
+		var body struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(req.reply, &body), tc.name)
+		assert.Equal(t, tc.errCode, body.Error.Code, tc.name)
+	}
+	repo.AssertNotCalled(t, "FindAggregated")
+}
+
+// TestKlineQueryService_LatestAndSymbols checks the happy paths of kline.latest and kline.symbols.
+func TestKlineQueryService_LatestAndSymbols(t *testing.T) {
+	utils.InitLogger()
+	repo := &mocks.MockKlineRepository{}
+	ctx := context.Background()
+
+	btc := models.Instrument{Exchange: models.ExchangeBinance, Market: models.MarketFutures, Symbol: "BTCUSDT"}
+	repo.On("FindLast", mock.Anything, btc).Return(models.Kline{Symbol: "BTCUSDT", ClosePrice: decimal.NewFromInt(42)}, nil)
+	repo.On("FindInstruments", mock.Anything, "").Return([]models.Instrument{btc}, nil)
+
+	req := &fakeRequest{data: []byte(`{"symbol":"BTCUSDT"}`)}
+	handler.KlineLatestEndpoint(ctx, repo, utils.Logger).Handle(req)
+	var latest struct {
+		Data models.Kline `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(req.reply, &latest))
+	assert.True(t, decimal.NewFromInt(42).Equal(latest.Data.ClosePrice))
+
+	req = &fakeRequest{} // an empty body lists every exchange
+	handler.KlineSymbolsEndpoint(ctx, repo, utils.Logger).Handle(req)
+	var symbols struct {
+		Data []models.Instrument `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(req.reply, &symbols))
+	assert.Equal(t, []models.Instrument{btc}, symbols.Data)
+}
@@ -0,0 +1,27 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	natsinfosir "infosir/pkg/nats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReplayOptions_Validate checks that a replay has one start position and a positive batch size.
+func TestReplayOptions_Validate(t *testing.T) {
+	assert.NoError(t, natsinfosir.ReplayOptions{BatchSize: 100}.Validate())
+	assert.NoError(t, natsinfosir.ReplayOptions{StartSeq: 42, BatchSize: 1}.Validate())
+	assert.NoError(t, natsinfosir.ReplayOptions{StartTime: time.Now(), BatchSize: 1}.Validate())
+
+	assert.Error(t, natsinfosir.ReplayOptions{StartSeq: 42, StartTime: time.Now(), BatchSize: 1}.Validate())
+	assert.Error(t, natsinfosir.ReplayOptions{}.Validate())
+}
+
+// TestReplayProgress_Percent checks progress over the replayed sequence range.
+func TestReplayProgress_Percent(t *testing.T) {
+	assert.Zero(t, natsinfosir.ReplayProgress{TargetSeq: 100}.Percent())
+	assert.InDelta(t, 50, natsinfosir.ReplayProgress{Messages: 10, FirstSeq: 51, LastSeq: 75, TargetSeq: 100}.Percent(), 0.01)
+	assert.InDelta(t, 100, natsinfosir.ReplayProgress{Messages: 1, FirstSeq: 100, LastSeq: 100, TargetSeq: 100}.Percent(), 0.01)
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"infosir/internal/jobs"
+	"infosir/internal/models"
+	"infosir/internal/utils"
+	"infosir/tests/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestNextTick_AlignsToCandleClose checks that ticks land on candle boundaries plus the settle delay.
+func TestNextTick_AlignsToCandleClose(t *testing.T) {
+	settle := 2 * time.Second
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	cases := []struct {
+		now      string
+		interval models.Interval
+		want     string
+	}{
+		{"2024-03-06T10:00:01Z", models.Interval1m, "2024-03-06T10:00:02Z"},      // still settling the 09:59 candle
+		{"2024-03-06T10:00:02Z", models.Interval1m, "2024-03-06T10:01:02Z"},      // exactly on the tick: the next one
+		{"2024-03-06T10:00:30Z", models.Interval1m, "2024-03-06T10:01:02Z"},      // mid-candle
+		{"2024-03-06T10:07:00Z", models.Interval5m, "2024-03-06T10:10:02Z"},      // 5m boundaries
+		{"2024-03-06T10:30:00Z", models.Interval4h, "2024-03-06T12:00:02Z"},      // 4h candles open at 00, 04, 08, 12 UTC
+		{"2024-03-06T10:30:00Z", models.Interval1d, "2024-03-07T00:00:02Z"},      // daily candles open at midnight UTC
+		{"2024-03-06T10:30:00Z", models.Interval1w, "2024-03-11T00:00:02Z"},      // weekly candles open on Mondays
+		{"2024-03-06T12:30:00+02:00", models.Interval1h, "2024-03-06T11:00:02Z"}, // zone doesn't shift boundaries
+	}
+	for _, c := range cases {
+		got := jobs.NextTick(at(c.now), c.interval, settle)
+		assert.True(t, got.Equal(at(c.want)), "%s %s: got %s, want %s", c.now, c.interval, got, c.want)
+	}
+}
+
+// TestFetchAndPublish_RequestsWindowEndingAtClosedCandle checks that a scheduled fetch asks for the
+// klines up to the candle that just closed, so that even a limit of 1 returns that candle.
+func TestFetchAndPublish_RequestsWindowEndingAtClosedCandle(t *testing.T) {
+	utils.InitLogger()
+	cfg := utils.GetConfig()
+	cfg.Crypto.Pairs = []string{"BTCUSDT"}
+	cfg.Crypto.BybitPairs, cfg.Crypto.OKXPairs = nil, nil
+	cfg.Crypto.FetchConcurrency = 1
+
+	closed := time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC)
+	candle := []models.Kline{{Time: closed, Symbol: "BTCUSDT", Interval: "5m", IsClosed: true}}
+
+	for _, c := range []struct {
+		limit int
+		start time.Time
+	}{
+		{1, closed},
+		{3, closed.Add(-10 * time.Minute)},
+	} {
+		cfg.Crypto.KlineLimit = c.limit
+		service := &mocks.MockInfoSirService{}
+		service.On("GetKlinesRange", mock.Anything, models.ExchangeBinance, "BTCUSDT", "5m", c.start, closed, int64(c.limit)).
+			Return(candle, nil)
+		service.On("PublishKlinesJS", mock.Anything, candle).Return(models.PublishAck{}, nil)
+
+		jobs.FetchAndPublish(context.Background(), service, nil, models.Interval5m, closed)
+
+		service.AssertExpectations(t)
+	}
+}
@@ -3,17 +3,20 @@ package tests
 import (
 	"context"
 	"testing"
+	"time"
 
 	"infosir/internal/models"
 	"infosir/internal/srv"
+	"infosir/pkg/crypto"
 	"infosir/tests/mocks"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 // TestInfoSirService_GetKlines is an example unit test that verifies
-// InfoSirService’s GetKlines method using a mocked BinanceClient.
+// InfoSirService’s GetKlines method using a mocked Binance ExchangeClient.
 func TestInfoSirService_GetKlines(t *testing.T) {
 	// 1. Create a context
 	ctx := context.Background()
@@ -23,7 +26,9 @@ func TestInfoSirService_GetKlines(t *testing.T) {
 	mockNats := &mocks.MockNatsClient{} // not used in this test, but we pass in to satisfy the constructor
 
 	// 3. Construct the service with the mocks
-	service := srv.NewInfoSirService(mockBinance, mockNats)
+	exchanges := srv.NewExchangeRegistry()
+	exchanges.Register(models.ExchangeBinance, mockBinance)
+	service := srv.NewInfoSirService(exchanges, mockNats)
 
 	// 4. Define test input and expected output
 	pair := "BTCUSDT"
@@ -32,13 +37,13 @@ func TestInfoSirService_GetKlines(t *testing.T) {
 	expectedKlines := []models.Kline{
 		{
 			Symbol:     pair,
-			OpenPrice:  100.0,
-			ClosePrice: 110.0,
+			OpenPrice:  decimal.NewFromInt(100),
+			ClosePrice: decimal.NewFromInt(110),
 		},
 		{
 			Symbol:     pair,
-			OpenPrice:  110.0,
-			ClosePrice: 120.0,
+			OpenPrice:  decimal.NewFromInt(110),
+			ClosePrice: decimal.NewFromInt(120),
 		},
 	}
 
@@ -48,7 +53,7 @@ func TestInfoSirService_GetKlines(t *testing.T) {
 		Return(expectedKlines, nil)
 
 	// 6. Call the method
-	actual, err := service.GetKlines(ctx, pair, interval, limit)
+	actual, err := service.GetKlines(ctx, models.ExchangeBinance, pair, interval, limit)
 
 	// 7. Validate
 	assert.NoError(t, err, "GetKlines should not return an error")
@@ -65,20 +70,79 @@ func TestInfoSirService_PublishKlinesJS(t *testing.T) {
 	mockBinance := &mocks.MockBinanceClient{} // not used in this test
 	mockNats := &mocks.MockNatsClient{}
 
-	service := srv.NewInfoSirService(mockBinance, mockNats)
+	exchanges := srv.NewExchangeRegistry()
+	exchanges.Register(models.ExchangeBinance, mockBinance)
+	service := srv.NewInfoSirService(exchanges, mockNats)
 
 	klines := []models.Kline{
-		{Symbol: "ETHUSDT", ClosePrice: 200.0},
+		{Symbol: "ETHUSDT", ClosePrice: decimal.NewFromInt(200)},
 	}
 
 	// We expect the nats mock to be called with these klines
 	mockNats.
 		On("PublishKlines", mock.Anything, klines).
-		Return(nil)
+		Return(models.PublishAck{Stream: "infosir_kline_stream", Sequence: 7}, nil)
 
-	err := service.PublishKlinesJS(ctx, klines)
+	ack, err := service.PublishKlinesJS(ctx, klines)
 	assert.NoError(t, err, "PublishKlinesJS should not fail")
+	assert.Equal(t, uint64(7), ack.Sequence, "ack should carry the stream sequence")
 
 	mockBinance.AssertExpectations(t)
 	mockNats.AssertExpectations(t)
 }
+
+// TestKlinePaginator_WalksRangeForward verifies that the paginator advances its cursor past
+// the last returned kline on every chunk and stops on a short page.
+func TestKlinePaginator_WalksRangeForward(t *testing.T) {
+	ctx := context.Background()
+	mockBinance := &mocks.MockBinanceClient{}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(4 * time.Minute)
+	at := func(min int) models.Kline {
+		return models.Kline{Symbol: "BTCUSDT", Time: start.Add(time.Duration(min) * time.Minute)}
+	}
+
+	mockBinance.On("FetchKlinesRange", mock.Anything, "BTCUSDT", "1m", start, end, int64(2)).
+		Return([]models.Kline{at(0), at(1)}, nil).Once()
+	mockBinance.On("FetchKlinesRange", mock.Anything, "BTCUSDT", "1m", start.Add(2*time.Minute), end, int64(2)).
+		Return([]models.Kline{at(2), at(3)}, nil).Once()
+	mockBinance.On("FetchKlinesRange", mock.Anything, "BTCUSDT", "1m", start.Add(4*time.Minute), end, int64(2)).
+		Return([]models.Kline{at(4)}, nil).Once()
+
+	pager, err := crypto.NewKlinePaginator(mockBinance, models.ExchangeBinance, "BTCUSDT", "1m", start, end, 2)
+	assert.NoError(t, err)
+
+	var all []models.Kline
+	for pager.Next(ctx) {
+		all = append(all, pager.Klines()...)
+	}
+
+	assert.NoError(t, pager.Err())
+	assert.Len(t, all, 5, "all klines of the range should be fetched")
+	assert.Equal(t, end.Add(time.Minute), pager.Cursor())
+	mockBinance.AssertExpectations(t)
+}
+
+// TestKlinePaginator_CapsLimitToExchangeMaximum checks that the chunk size is capped to what OKX
+// serves per request, so that an empty window skips only the candles that were actually requested.
+func TestKlinePaginator_CapsLimitToExchangeMaximum(t *testing.T) {
+	ctx := context.Background()
+	client := &mocks.MockBinanceClient{}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(150 * time.Minute)
+	resume := start.Add(100 * time.Minute)
+
+	client.On("FetchKlinesRange", mock.Anything, "BTC-USDT", "1m", start, end, int64(100)).
+		Return([]models.Kline{}, nil).Once()
+	client.On("FetchKlinesRange", mock.Anything, "BTC-USDT", "1m", resume, end, int64(100)).
+		Return([]models.Kline{{Symbol: "BTCUSDT", Time: resume}}, nil).Once()
+
+	pager, err := crypto.NewKlinePaginator(client, models.ExchangeOKX, "BTC-USDT", "1m", start, end, 1000)
+	assert.NoError(t, err)
+
+	assert.True(t, pager.Next(ctx))
+	assert.Equal(t, resume, pager.Klines()[0].Time, "the empty window must be skipped by 100 candles, not 1000")
+	client.AssertExpectations(t)
+}